@@ -3,12 +3,17 @@ package controllers
 import (
 	"blockcade/models"
 	"blockcade/utils"
+	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"time"
+	"sync"
 
 	"github.com/astaxie/beego"
+	"golang.org/x/net/websocket"
 )
 
 // GameController 游戏控制器
@@ -21,21 +26,339 @@ type GameRequest struct {
 	Direction string `json:"direction"`
 }
 
+// NewGameRequest 创建游戏请求结构
+type NewGameRequest struct {
+	Seed          *int64 `json:"seed,omitempty"`          // 可选的随机种子，范围为[0, 2^53)，不传则由服务器生成；指定种子的游戏不能提交成绩
+	Mode          string `json:"mode,omitempty"`          // 可选的游戏模式，默认为经典模式
+	Level         string `json:"level,omitempty"`         // 可选的关卡名称，默认为空白棋盘
+	Width         int    `json:"width,omitempty"`         // 可选的棋盘宽度，必须在服务器允许的范围内，使用关卡时不能指定
+	Height        int    `json:"height,omitempty"`        // 可选的棋盘高度，同上
+	Players       int    `json:"players,omitempty"`       // 可选的玩家数量（包括机器人），大于1时创建多人游戏，默认为1加机器人数量
+	Bots          int    `json:"bots,omitempty"`          // 可选的机器人数量，机器人占据创建者之后的座位
+	BotDifficulty string `json:"botDifficulty,omitempty"` // 可选的机器人难度：easy、normal（默认）或hard
+	Countdown     bool   `json:"countdown,omitempty"`     // 可选，开始前进行3-2-1倒计时
+}
+
+// AddBotRequest 添加机器人请求结构
+type AddBotRequest struct {
+	Difficulty string `json:"difficulty,omitempty"` // 机器人难度，默认为normal
+}
+
+// AddBotResponse 添加机器人响应结构
+type AddBotResponse struct {
+	SnakeID int `json:"snakeId"`
+}
+
+// NewGameResponse 创建游戏响应结构
+// ControlToken只在创建时返回一次，操作游戏时需要通过X-Control-Token请求头提供
+type NewGameResponse struct {
+	*models.Game
+	SnakeID      int    `json:"snakeId"`
+	ControlToken string `json:"controlToken"`
+}
+
+// JoinGameResponse 加入游戏响应结构
+type JoinGameResponse struct {
+	GameID       string `json:"gameId"`
+	SnakeID      int    `json:"snakeId"`
+	ControlToken string `json:"controlToken"`
+}
+
+// controlTokenHeader 控制令牌请求头
+const controlTokenHeader = "X-Control-Token"
+
+// 排行榜单次最多返回的记录数，以及查询排名时前后最多返回的记录数
+const (
+	maxLeaderboardLimit  = 100
+	maxLeaderboardWindow = 50
+)
+
+// controlToken 读取请求头中的控制令牌
+// 令牌不放在查询参数中，以免出现在访问日志和Referer里；只有WebSocket例外，见GameSocket
+func (c *GameController) controlToken() string {
+	return c.Ctx.Input.Header(controlTokenHeader)
+}
+
+// authorize 校验控制令牌，返回令牌控制的蛇ID；失败时写入错误响应并返回false
+func (c *GameController) authorize(gameID string) (int, bool) {
+	snakeID, err := utils.GetGameManager().CheckControlToken(gameID, c.controlToken())
+	if err == nil {
+		return snakeID, true
+	}
+	c.Data["json"] = map[string]string{"error": err.Error()}
+	c.Ctx.Output.Status = gameErrorStatus(err)
+	c.ServeJSON()
+	return 0, false
+}
+
 // NewGame 创建新游戏
 // @Title 创建新游戏
-// @Description 创建一个新的游戏实例
-// @Success 200 {object} models.Game
+// @Description 创建一个新的游戏实例，并返回操作该游戏所需的控制令牌；登录玩家创建的游戏关联玩家ID
+// @Param Authorization header string false "Bearer 会话令牌，不传时以游客身份游戏"
+// @Param request body NewGameRequest false "创建游戏请求"
+// @Success 200 {object} NewGameResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
 // @router /api/game [post]
 func (c *GameController) NewGame() {
-	// 生成游戏ID（可以使用UUID，但为了简化，这里使用时间戳）
-	gameID := time.Now().Format("20060102150405") + "-" + c.Ctx.Request.RemoteAddr
+	session, ok := requestSession(&c.Controller)
+	if !ok {
+		return
+	}
+
+	// 解析请求体（可以为空）
+	requestBody, err := io.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		beego.Error("读取请求体失败:", err)
+		c.Data["json"] = map[string]string{"error": "读取请求体失败"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return
+	}
+
+	var req NewGameRequest
+	if len(bytes.TrimSpace(requestBody)) > 0 {
+		if err := json.Unmarshal(requestBody, &req); err != nil {
+			c.Data["json"] = map[string]string{"error": "无效的请求格式"}
+			c.Ctx.Output.Status = http.StatusBadRequest
+			c.ServeJSON()
+			return
+		}
+	}
+
+	opts := models.GameOptions{Seed: models.NewSeed(), Mode: models.GameModeClassic}
+	if req.Seed != nil {
+		if !models.IsValidSeed(*req.Seed) {
+			c.Data["json"] = map[string]string{"error": "随机种子必须在0到2^53之间"}
+			c.Ctx.Output.Status = http.StatusBadRequest
+			c.ServeJSON()
+			return
+		}
+		opts.Seed, opts.CustomSeed = *req.Seed, true
+	}
+	if req.Mode != "" {
+		if !models.IsValidMode(req.Mode) {
+			c.Data["json"] = map[string]string{"error": "无效的游戏模式"}
+			c.Ctx.Output.Status = http.StatusBadRequest
+			c.ServeJSON()
+			return
+		}
+		opts.Mode = req.Mode
+	}
+	if req.Level != "" {
+		utils.RefreshLevel(req.Level)
+		level, ok := models.GetLevel(req.Level)
+		if !ok {
+			c.Data["json"] = map[string]string{"error": "关卡不存在"}
+			c.Ctx.Output.Status = http.StatusBadRequest
+			c.ServeJSON()
+			return
+		}
+		if req.Players > len(level.Spawns) || req.Bots >= len(level.Spawns) {
+			c.Data["json"] = map[string]string{"error": "玩家数量超过关卡的出生点数量"}
+			c.Ctx.Output.Status = http.StatusBadRequest
+			c.ServeJSON()
+			return
+		}
+		opts.Level = req.Level
+		opts.LevelVersion = level.Version
+	}
+	gameManager := utils.GetGameManager()
+	if req.Width != 0 || req.Height != 0 {
+		minSize, maxSize := gameManager.BoardSizeRange()
+		if req.Level != "" {
+			c.Data["json"] = map[string]string{"error": "关卡的棋盘大小不能修改"}
+			c.Ctx.Output.Status = http.StatusBadRequest
+			c.ServeJSON()
+			return
+		}
+		if (req.Width != 0 && (req.Width < minSize || req.Width > maxSize)) ||
+			(req.Height != 0 && (req.Height < minSize || req.Height > maxSize)) {
+			c.Data["json"] = map[string]string{"error": fmt.Sprintf("棋盘边长必须在%d到%d之间", minSize, maxSize)}
+			c.Ctx.Output.Status = http.StatusBadRequest
+			c.ServeJSON()
+			return
+		}
+		opts.Width, opts.Height = req.Width, req.Height
+	}
+	if req.Players == 0 {
+		req.Players = 1 + req.Bots
+	}
+	if req.Players < 1 || req.Players > models.MaxPlayers || req.Bots < 0 || req.Bots >= req.Players {
+		c.Data["json"] = map[string]string{"error": "无效的玩家数量"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return
+	}
+	opts.Players = req.Players
+	if req.Countdown {
+		opts.Countdown = gameManager.Countdown()
+	}
+	if req.BotDifficulty == "" {
+		req.BotDifficulty = models.BotNormal
+	}
+	if !models.IsValidBotDifficulty(req.BotDifficulty) {
+		c.Data["json"] = map[string]string{"error": "无效的机器人难度"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return
+	}
+
+	// 生成不可猜测的游戏ID
+	gameID := utils.NewGameID()
+
+	// 创建游戏
+	game, token := gameManager.CreateGame(gameID, opts, sessionPlayerID(session))
+	for i := 0; i < req.Bots; i++ {
+		if _, err := gameManager.AddBot(gameID, req.BotDifficulty); err != nil {
+			beego.Error("添加机器人失败:", gameID, err)
+		}
+	}
+	if req.Bots > 0 {
+		// 机器人入座后游戏可能已经开始，返回最新状态
+		if latest, err := gameManager.GetGame(gameID); err == nil {
+			game = latest
+		}
+	}
+
+	// 返回游戏信息和控制令牌
+	c.Data["json"] = NewGameResponse{Game: game, SnakeID: 0, ControlToken: token}
+	c.ServeJSON()
+}
+
+// JoinGame 加入多人游戏
+// @Title 加入多人游戏
+// @Description 加入等待中的多人游戏，返回分配到的蛇ID和控制令牌，所有玩家加入后游戏开始
+// @Param id path string true "游戏ID"
+// @Param Authorization header string false "Bearer 会话令牌，不传时以游客身份游戏"
+// @Success 200 {object} JoinGameResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @router /api/game/:id/join [post]
+func (c *GameController) JoinGame() {
+	gameID := c.Ctx.Input.Param(":id")
+	session, ok := requestSession(&c.Controller)
+	if !ok {
+		return
+	}
 
-	// 获取游戏管理器并创建游戏
 	gameManager := utils.GetGameManager()
-	game := gameManager.CreateGame(gameID)
+	snakeID, token, err := gameManager.JoinGame(gameID, sessionPlayerID(session))
+	if err != nil {
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = gameErrorStatus(err)
+	} else {
+		c.Data["json"] = JoinGameResponse{GameID: gameID, SnakeID: snakeID, ControlToken: token}
+	}
+
+	c.ServeJSON()
+}
+
+// AddBot 添加机器人
+// @Title 添加机器人
+// @Description 让机器人占据等待中的多人游戏的空位，需要游戏中任一玩家的控制令牌
+// @Param id path string true "游戏ID"
+// @Param X-Control-Token header string true "控制令牌"
+// @Param request body AddBotRequest false "添加机器人请求"
+// @Success 200 {object} AddBotResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @router /api/game/:id/bots [post]
+func (c *GameController) AddBot() {
+	gameID := c.Ctx.Input.Param(":id")
+
+	if _, ok := c.authorize(gameID); !ok {
+		return
+	}
+
+	var req AddBotRequest
+	requestBody, err := io.ReadAll(c.Ctx.Request.Body)
+	if err == nil && len(bytes.TrimSpace(requestBody)) > 0 {
+		err = json.Unmarshal(requestBody, &req)
+	}
+	if err != nil {
+		c.Data["json"] = map[string]string{"error": "无效的请求格式"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return
+	}
+	if req.Difficulty == "" {
+		req.Difficulty = models.BotNormal
+	}
+	if !models.IsValidBotDifficulty(req.Difficulty) {
+		c.Data["json"] = map[string]string{"error": "无效的机器人难度"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return
+	}
+
+	snakeID, err := utils.GetGameManager().AddBot(gameID, req.Difficulty)
+	if err != nil {
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = gameErrorStatus(err)
+	} else {
+		c.Data["json"] = AddBotResponse{SnakeID: snakeID}
+	}
+
+	c.ServeJSON()
+}
+
+// PauseGame 暂停游戏
+// @Title 暂停游戏
+// @Description 暂停运行中的游戏，暂停期间游戏时间和所有计时都停止；每位玩家的暂停次数和单次暂停时长有限，超时后自动继续
+// @Param id path string true "游戏ID"
+// @Param X-Control-Token header string true "控制令牌"
+// @Success 200 {object} SuccessResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @router /api/game/:id/pause [post]
+func (c *GameController) PauseGame() {
+	gameID := c.Ctx.Input.Param(":id")
+
+	snakeID, ok := c.authorize(gameID)
+	if !ok {
+		return
+	}
+
+	if err := utils.GetGameManager().PauseGame(gameID, snakeID); err != nil {
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = gameErrorStatus(err)
+	} else {
+		c.Data["json"] = map[string]string{"success": "游戏已暂停"}
+	}
+
+	c.ServeJSON()
+}
+
+// ResumeGame 继续游戏
+// @Title 继续游戏
+// @Description 继续暂停的游戏，游戏先进入倒计时再继续运行，游戏中的任一玩家都可以继续
+// @Param id path string true "游戏ID"
+// @Param X-Control-Token header string true "控制令牌"
+// @Success 200 {object} SuccessResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @router /api/game/:id/resume [post]
+func (c *GameController) ResumeGame() {
+	gameID := c.Ctx.Input.Param(":id")
+
+	snakeID, ok := c.authorize(gameID)
+	if !ok {
+		return
+	}
+
+	if err := utils.GetGameManager().ResumeGame(gameID, snakeID); err != nil {
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = gameErrorStatus(err)
+	} else {
+		c.Data["json"] = map[string]string{"success": "游戏已继续"}
+	}
 
-	// 返回游戏信息
-	c.Data["json"] = game
 	c.ServeJSON()
 }
 
@@ -45,17 +368,18 @@ func (c *GameController) NewGame() {
 // @Param id path string true "游戏ID"
 // @Success 200 {object} models.Game
 // @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse
 // @router /api/game/:id [get]
 func (c *GameController) GetGame() {
 	gameID := c.Ctx.Input.Param(":id")
 
 	// 获取游戏管理器
 	gameManager := utils.GetGameManager()
-	game, exists := gameManager.GetGame(gameID)
+	game, err := gameManager.GetGame(gameID)
 
-	if !exists {
-		c.Data["json"] = map[string]string{"error": "游戏不存在"}
-		c.Ctx.Output.Status = http.StatusNotFound
+	if err != nil {
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = gameErrorStatus(err)
 	} else {
 		c.Data["json"] = game
 	}
@@ -63,19 +387,46 @@ func (c *GameController) GetGame() {
 	c.ServeJSON()
 }
 
+// gameErrorStatus 将游戏管理器返回的错误转换为HTTP状态码
+func gameErrorStatus(err error) int {
+	switch err {
+	case utils.ErrGameNotFound:
+		return http.StatusNotFound
+	case utils.ErrGameExpired:
+		return http.StatusGone
+	case utils.ErrRecordExists, utils.ErrGameFull, utils.ErrNotRunning, utils.ErrNotPaused:
+		return http.StatusConflict
+	case utils.ErrPauseLimit:
+		return http.StatusTooManyRequests
+	case utils.ErrInvalidToken, utils.ErrCustomSeed:
+		return http.StatusForbidden
+	case utils.ErrGameRemote:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
 // UpdateDirection 更新游戏方向
 // @Title 更新游戏方向
-// @Description 更新蛇的移动方向
+// @Description 更新控制令牌对应的蛇的移动方向
 // @Param id path string true "游戏ID"
+// @Param X-Control-Token header string true "控制令牌"
 // @Param direction body object true "方向请求"
 // @Success 200 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @router /api/game/:id/direction [post]
 func (c *GameController) UpdateDirection() {
 	gameID := c.Ctx.Input.Param(":id")
 	beego.Info("接收到更新方向请求，游戏ID:", gameID)
 
+	snakeID, ok := c.authorize(gameID)
+	if !ok {
+		return
+	}
+
 	// 记录请求体原始内容
 	// TODO: 这里接收不到具体的数据
 	requestBody, err := io.ReadAll(c.Ctx.Request.Body)
@@ -116,17 +467,8 @@ func (c *GameController) UpdateDirection() {
 	}
 
 	// 转换方向字符串为枚举值
-	var direction models.Direction
-	switch directionStr {
-	case "up":
-		direction = models.Up
-	case "down":
-		direction = models.Down
-	case "left":
-		direction = models.Left
-	case "right":
-		direction = models.Right
-	default:
+	direction, ok := parseDirection(directionStr)
+	if !ok {
 		beego.Error("无效的方向值:", directionStr)
 		c.Data["json"] = map[string]string{"error": "无效的方向"}
 		c.Ctx.Output.Status = http.StatusBadRequest
@@ -137,7 +479,7 @@ func (c *GameController) UpdateDirection() {
 
 	// 获取游戏管理器并更新方向
 	gameManager := utils.GetGameManager()
-	if success := gameManager.UpdateGameDirection(gameID, direction); !success {
+	if success := gameManager.UpdateGameDirection(gameID, snakeID, direction); !success {
 		c.Data["json"] = map[string]string{"error": "游戏不存在或已结束"}
 		c.Ctx.Output.Status = http.StatusNotFound
 	} else {
@@ -147,24 +489,194 @@ func (c *GameController) UpdateDirection() {
 	c.ServeJSON()
 }
 
+// GetReplay 获取游戏录像
+// @Title 获取游戏录像
+// @Description 下载游戏的随机种子、规则和所有被接受的方向变化，用于复现整局游戏
+// @Param id path string true "游戏ID"
+// @Success 200 {object} models.Replay
+// @Failure 404 {object} ErrorResponse
+// @router /api/game/:id/replay [get]
+func (c *GameController) GetReplay() {
+	gameID := c.Ctx.Input.Param(":id")
+
+	// 获取游戏管理器
+	gameManager := utils.GetGameManager()
+	replay, exists := gameManager.GetReplay(gameID)
+
+	if !exists {
+		c.Data["json"] = map[string]string{"error": "游戏不存在"}
+		c.Ctx.Output.Status = http.StatusNotFound
+	} else {
+		c.Ctx.Output.Header("Content-Disposition", "attachment; filename=\"replay-"+gameID+".json\"")
+		c.Data["json"] = replay
+	}
+
+	c.ServeJSON()
+}
+
+// GameSocket 游戏状态WebSocket
+// @Title 游戏状态WebSocket
+// @Description 建立WebSocket连接，服务器每次更新游戏后推送最新状态，持有控制令牌的客户端可通过同一连接发送方向
+// @Param id path string true "游戏ID"
+// @Param X-Control-Token header string false "控制令牌，不提供时只能观战"
+// @Param token query string false "控制令牌，浏览器无法设置请求头时使用"
+// @Failure 404 {object} ErrorResponse
+// @router /api/game/:id/ws [get]
+func (c *GameController) GameSocket() {
+	gameID := c.Ctx.Input.Param(":id")
+
+	// 获取游戏管理器并订阅游戏状态
+	gameManager := utils.GetGameManager()
+	game, err := gameManager.GetGame(gameID)
+	if err != nil {
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = gameErrorStatus(err)
+		c.ServeJSON()
+		return
+	}
+	updates, unsubscribe, subscribed := gameManager.Subscribe(gameID)
+	if !subscribed {
+		c.Data["json"] = map[string]string{"error": "游戏不存在"}
+		c.Ctx.Output.Status = http.StatusNotFound
+		c.ServeJSON()
+		return
+	}
+	defer unsubscribe()
+
+	// 只有持有控制令牌的连接可以发送方向，其余连接只能观战
+	// 浏览器的WebSocket无法设置请求头，因此这里也接受token查询参数
+	token := c.controlToken()
+	if token == "" {
+		token = c.GetString("token")
+	}
+	snakeID, err := gameManager.CheckControlToken(gameID, token)
+	canControl := err == nil
+
+	// 连接被接管后不再渲染响应
+	c.EnableRender = false
+
+	server := websocket.Server{
+		// 与CORS策略保持一致，接受任意来源
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			var sendMutex sync.Mutex
+			send := func(v interface{}) error {
+				sendMutex.Lock()
+				defer sendMutex.Unlock()
+				return websocket.JSON.Send(ws, v)
+			}
+
+			// 读取客户端发送的方向
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					var req GameRequest
+					if err := websocket.JSON.Receive(ws, &req); err != nil {
+						return
+					}
+
+					if !canControl {
+						send(map[string]string{"error": utils.ErrInvalidToken.Error()})
+						continue
+					}
+
+					direction, ok := parseDirection(req.Direction)
+					if !ok {
+						send(map[string]string{"error": "无效的方向"})
+						continue
+					}
+					if !gameManager.UpdateGameDirection(gameID, snakeID, direction) {
+						send(map[string]string{"error": "游戏不存在或已结束"})
+					}
+				}
+			}()
+
+			// 先推送当前状态，再推送每次更新后的状态
+			if err := send(game); err != nil {
+				return
+			}
+			for {
+				select {
+				case state, ok := <-updates:
+					if !ok {
+						return
+					}
+					if err := send(state); err != nil {
+						return
+					}
+					if state.Status == models.GameStatusEnded {
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Ctx.ResponseWriter, c.Ctx.Request)
+}
+
+// parseDirection 转换方向字符串为枚举值
+func parseDirection(directionStr string) (models.Direction, bool) {
+	switch directionStr {
+	case "up":
+		return models.Up, true
+	case "down":
+		return models.Down, true
+	case "left":
+		return models.Left, true
+	case "right":
+		return models.Right, true
+	}
+	return 0, false
+}
+
+// releaseRecord 撤销成绩提交标记以便重试，失败时只记录日志
+func releaseRecord(gameID string, snakeID int) {
+	if err := utils.GetGameManager().ReleaseRecord(gameID, snakeID); err != nil {
+		beego.Error("撤销成绩提交标记失败:", gameID, snakeID, err)
+	}
+}
+
 // SaveRecord 保存游戏记录
 // @Title 保存游戏记录
-// @Description 保存游戏得分记录
+// @Description 保存控制令牌对应的蛇的得分记录。登录玩家的成绩使用玩家的名称；
+// 游客不能使用已注册的名称，游客的成绩返回认领令牌，注册后可以用它认领成绩；指定随机种子的游戏不能提交
 // @Param id path string true "游戏ID"
+// @Param X-Control-Token header string true "控制令牌"
 // @Param request body SaveRecordRequest true "记录请求"
-// @Success 200 {object} SuccessResponse
+// @Success 200 {object} SaveRecordResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @router /api/game/:id/record [post]
 
 // SaveRecordRequest 保存记录请求结构
+// 得分、时间和豆子数量以服务器端的游戏状态为准，Score仅用于校验客户端显示是否一致
 type SaveRecordRequest struct {
-	PlayerName string `json:"playerName"`
-	Score      int    `json:"score"`
+	PlayerName string `json:"playerName"` // 游客的名称，登录玩家的成绩使用玩家的名称
+	Score      *int   `json:"score,omitempty"`
+}
+
+// SaveRecordResponse 保存记录响应结构
+type SaveRecordResponse struct {
+	Success    string `json:"success"`
+	RecordID   int64  `json:"recordId,omitempty"`   // 成绩记录ID，用于查询排名
+	ClaimToken string `json:"claimToken,omitempty"` // 游客成绩的认领令牌，注册时提供以认领成绩
 }
 
 func (c *GameController) SaveRecord() {
 	gameID := c.Ctx.Input.Param(":id")
 
+	snakeID, ok := c.authorize(gameID)
+	if !ok {
+		return
+	}
+
 	// 解析请求体
 	requestBody, err := io.ReadAll(c.Ctx.Request.Body)
 	if err != nil {
@@ -184,82 +696,240 @@ func (c *GameController) SaveRecord() {
 		return
 	}
 
-	// 获取游戏管理器
+	// 标记成绩已提交，同时拿到服务器端的游戏和蛇的快照；客户端提交的得分必须与服务器端一致
 	gameManager := utils.GetGameManager()
-	game, exists := gameManager.GetGame(gameID)
-
-	if !exists {
-		c.Data["json"] = map[string]string{"error": "游戏不存在"}
-		c.Ctx.Output.Status = http.StatusNotFound
+	game, snake, err := gameManager.ClaimRecord(gameID, snakeID, req.Score)
+	if err != nil {
+		if err == utils.ErrScoreMismatch {
+			beego.Warn("提交的得分与服务器不一致，游戏ID:", gameID, "提交:", *req.Score)
+		}
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = gameErrorStatus(err)
 		c.ServeJSON()
 		return
 	}
 
+	// 登录玩家使用玩家的名称；游客不能冒用注册玩家的名称，保存认领令牌的摘要以便注册后认领
+	var playerID sql.NullInt64
+	var claimHash sql.NullString
+	var claimToken string
+	playerName := req.PlayerName
+	if snake.PlayerID != 0 {
+		player, err := utils.GetPlayer(snake.PlayerID)
+		if err != nil {
+			beego.Error("获取玩家失败:", snake.PlayerID, err)
+			releaseRecord(gameID, snakeID)
+			c.Data["json"] = map[string]string{"error": "保存记录失败"}
+			c.Ctx.Output.Status = http.StatusInternalServerError
+			c.ServeJSON()
+			return
+		}
+		playerID = sql.NullInt64{Int64: player.ID, Valid: true}
+		playerName = player.Name
+	} else {
+		registered, err := utils.IsRegisteredName(playerName)
+		if err != nil {
+			beego.Error("检查玩家名称失败:", err)
+		}
+		if registered {
+			releaseRecord(gameID, snakeID)
+			c.Data["json"] = map[string]string{"error": "该名称已被注册玩家使用，请登录或换一个名称"}
+			c.Ctx.Output.Status = http.StatusConflict
+			c.ServeJSON()
+			return
+		}
+		if utils.DB != nil {
+			var hash string
+			claimToken, hash = utils.NewClaimToken()
+			claimHash = sql.NullString{String: hash, Valid: true}
+		}
+	}
+
 	// 保存记录到数据库
+	record := utils.LeaderboardRecord{
+		Score: snake.Score,
+		Board: utils.LeaderboardBoard{Mode: game.Mode, Level: game.Level, LevelVersion: game.LevelVersion, Width: game.Width, Height: game.Height},
+	}
 	if utils.DB != nil {
-		_, err := utils.DB.Exec(
-			"INSERT INTO game_records (score, time_played, food_count, player_name) VALUES ($1, $2, $3, $4)",
-			req.Score, game.Time, game.FoodCount, req.PlayerName,
-		)
+		err := utils.DB.QueryRow(
+			"INSERT INTO game_records (score, time_played, food_count, player_name, game_id, snake_id, death_cause, level, level_version, board_width, board_height, mode, player_id, claim_hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id, created_at",
+			snake.Score, snake.Time, snake.FoodCount, playerName, game.ID, snake.ID, snake.DeathCause, game.Level, game.LevelVersion, game.Width, game.Height, game.Mode, playerID, claimHash,
+		).Scan(&record.ID, &record.CreatedAt)
 		if err != nil {
+			if utils.IsUniqueViolation(err) {
+				c.Data["json"] = map[string]string{"error": utils.ErrRecordExists.Error()}
+				c.Ctx.Output.Status = http.StatusConflict
+				c.ServeJSON()
+				return
+			}
 			beego.Error("Failed to save game record:", err)
+			releaseRecord(gameID, snakeID)
 			c.Data["json"] = map[string]string{"error": "保存记录失败"}
 			c.Ctx.Output.Status = http.StatusInternalServerError
 			c.ServeJSON()
 			return
 		}
+		utils.AddLeaderboardRecord(record)
 	}
 
-	c.Data["json"] = map[string]string{"success": "记录保存成功"}
+	c.Data["json"] = SaveRecordResponse{Success: "记录保存成功", RecordID: record.ID, ClaimToken: claimToken}
+	c.ServeJSON()
+}
+
+// GetModes 获取游戏模式
+// @Title 获取游戏模式
+// @Description 列出所有游戏模式及其规则
+// @Success 200 {array} models.Rules
+// @router /api/modes [get]
+func (c *GameController) GetModes() {
+	c.Data["json"] = models.ListRules()
 	c.ServeJSON()
 }
 
 // GetLeaderboard 获取排行榜
 // @Title 获取排行榜
-// @Description 获取游戏得分排行榜
-// @Param limit query int false "限制数量" default(10)
-// @Success 200 {array} LeaderboardItem
+// @Description 获取当日、本周、本月或总排行榜，每种模式、每个关卡的每个版本、空白棋盘的每种大小单独排名
+// @Param limit query int false "限制数量，最多100" default(10)
+// @Param period query string false "排行榜周期：daily、weekly、monthly、all" default(all)
+// @Param mode query string false "游戏模式" default(classic)
+// @Param level query string false "关卡名称，不传时为空白棋盘的排行榜"
+// @Param levelVersion query int false "关卡版本，默认为当前版本"
+// @Param width query int false "空白棋盘的宽度，默认为服务器的默认大小"
+// @Param height query int false "空白棋盘的高度，默认为服务器的默认大小"
+// @Success 200 {array} utils.LeaderboardItem
+// @Failure 400 {object} ErrorResponse
 // @router /api/leaderboard [get]
 func (c *GameController) GetLeaderboard() {
 	// 获取限制参数
-	limit := c.GetString("limit")
-	if limit == "" {
-		limit = "10"
+	limit, err := c.GetInt("limit", 10)
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	if limit > maxLeaderboardLimit {
+		limit = maxLeaderboardLimit
 	}
 
-	// 从数据库查询排行榜
-	type LeaderboardItem struct {
-		Score      int       `json:"score"`
-		TimePlayed int       `json:"time_played"`
-		FoodCount  int       `json:"food_count"`
-		CreatedAt  time.Time `json:"created_at"`
+	period, ok := c.leaderboardPeriod()
+	if !ok {
+		return
 	}
 
-	var items []LeaderboardItem
+	items, err := utils.GetLeaderboard(c.leaderboardBoard(), period, limit)
+	if err != nil {
+		beego.Error("Failed to get leaderboard:", err)
+		items = []utils.LeaderboardItem{}
+	}
 
-	if utils.DB != nil {
-		rows, err := utils.DB.Query(
-			"SELECT score, time_played, food_count, created_at FROM game_records ORDER BY score DESC LIMIT $1",
-			limit,
-		)
-		if err != nil {
-			beego.Error("Failed to get leaderboard:", err)
-			c.Data["json"] = []LeaderboardItem{}
-			c.ServeJSON()
-			return
-		}
-		defer rows.Close()
+	c.Data["json"] = items
+	c.ServeJSON()
+}
 
-		for rows.Next() {
-			var item LeaderboardItem
-			if err := rows.Scan(&item.Score, &item.TimePlayed, &item.FoodCount, &item.CreatedAt); err != nil {
-				beego.Error("Failed to scan leaderboard row:", err)
-				continue
-			}
-			items = append(items, item)
+// GetLeaderboardRank 获取排名
+// @Title 获取排名
+// @Description 获取一条成绩或一位玩家的最好成绩在排行榜上的排名、百分位和成绩总数，以及前后各k条成绩。
+// 按成绩查询时使用成绩所属的排行榜，按玩家查询时排行榜由mode、level等参数决定
+// @Param record query int false "成绩记录ID，与player二选一"
+// @Param player query string false "玩家名称，与record二选一"
+// @Param k query int false "前后各返回多少条成绩，最多50" default(5)
+// @Param period query string false "排行榜周期：daily、weekly、monthly、all" default(all)
+// @Param mode query string false "游戏模式" default(classic)
+// @Param level query string false "关卡名称，不传时为空白棋盘的排行榜"
+// @Param levelVersion query int false "关卡版本，默认为当前版本"
+// @Param width query int false "空白棋盘的宽度，默认为服务器的默认大小"
+// @Param height query int false "空白棋盘的高度，默认为服务器的默认大小"
+// @Success 200 {object} utils.LeaderboardPosition
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @router /api/leaderboard/rank [get]
+func (c *GameController) GetLeaderboardRank() {
+	k, err := c.GetInt("k", 5)
+	if err != nil || k < 0 {
+		k = 5
+	}
+	if k > maxLeaderboardWindow {
+		k = maxLeaderboardWindow
+	}
+
+	period, ok := c.leaderboardPeriod()
+	if !ok {
+		return
+	}
+
+	recordID, _ := c.GetInt64("record")
+	player := c.GetString("player")
+	if (recordID > 0) == (player != "") {
+		c.Data["json"] = map[string]string{"error": "需要提供record或player其中之一"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return
+	}
+
+	var record *utils.LeaderboardRecord
+	if recordID > 0 {
+		record, err = utils.GetLeaderboardRecord(recordID)
+	} else {
+		record, err = utils.FindPlayerRecord(c.leaderboardBoard(), period, player)
+	}
+	var position *utils.LeaderboardPosition
+	if err == nil {
+		position, err = utils.GetLeaderboardPosition(record, period, k)
+	}
+	if err != nil {
+		switch err {
+		case utils.ErrRecordNotFound, utils.ErrPlayerNotRanked, utils.ErrRecordNotInPeriod:
+			c.Ctx.Output.Status = http.StatusNotFound
+		default:
+			beego.Error("Failed to get leaderboard rank:", err)
+			c.Ctx.Output.Status = http.StatusInternalServerError
+			err = errors.New("获取排名失败")
 		}
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.ServeJSON()
+		return
 	}
 
-	c.Data["json"] = items
+	c.Data["json"] = position
 	c.ServeJSON()
 }
+
+// leaderboardPeriod 读取排行榜周期参数，默认为总排行榜；无效时写入错误响应并返回false
+func (c *GameController) leaderboardPeriod() (string, bool) {
+	period := c.GetString("period")
+	if period == "" {
+		period = utils.PeriodAll
+	}
+	if !utils.IsValidPeriod(period) {
+		c.Data["json"] = map[string]string{"error": utils.ErrInvalidPeriod.Error()}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return "", false
+	}
+	return period, true
+}
+
+// leaderboardBoard 根据查询参数确定排行榜分组
+func (c *GameController) leaderboardBoard() utils.LeaderboardBoard {
+	// 不同模式的计分规则不同，成绩不可比
+	board := utils.LeaderboardBoard{Mode: c.GetString("mode")}
+	if board.Mode == "" {
+		board.Mode = models.GameModeClassic
+	}
+
+	// 关卡修改后旧版本的成绩不再可比，默认只看当前版本
+	board.Level = c.GetString("level")
+	board.LevelVersion, _ = c.GetInt("levelVersion")
+	if board.Level != "" && board.LevelVersion == 0 {
+		utils.RefreshLevel(board.Level)
+		board.LevelVersion = models.LatestLevelVersion(board.Level)
+	}
+
+	// 不同大小的棋盘成绩不可比，关卡的大小由关卡本身决定
+	board.Width, board.Height = utils.GetGameManager().DefaultBoardSize()
+	if w, err := c.GetInt("width"); err == nil && w > 0 {
+		board.Width = w
+	}
+	if h, err := c.GetInt("height"); err == nil && h > 0 {
+		board.Height = h
+	}
+	return board
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"blockcade/models"
+	"blockcade/utils"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/astaxie/beego"
+)
+
+// LevelController 关卡编辑控制器
+type LevelController struct {
+	beego.Controller
+}
+
+// LevelRequest 创建或修改关卡请求结构
+type LevelRequest struct {
+	Name string `json:"name"` // 关卡名称，修改时以路径中的名称为准
+	Map  string `json:"map"`  // ASCII格式的地图
+}
+
+// LevelErrorResponse 关卡校验失败响应结构
+type LevelErrorResponse struct {
+	Error  string   `json:"error"`
+	Errors []string `json:"errors"` // 发现的所有问题
+}
+
+// levelErrorStatus 将关卡编辑返回的错误转换为HTTP状态码
+func levelErrorStatus(err error) int {
+	switch err {
+	case utils.ErrLevelNotFound:
+		return http.StatusNotFound
+	case utils.ErrLevelExists:
+		return http.StatusConflict
+	case utils.ErrLevelBuiltin, utils.ErrLevelNotOwner:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ListLevels 列出关卡
+// @Title 列出关卡
+// @Description 列出所有可用关卡的当前版本，包括levels目录中的内置关卡和编辑器保存的关卡
+// @Success 200 {array} models.Level
+// @router /api/levels [get]
+func (c *LevelController) ListLevels() {
+	c.Data["json"] = models.ListLevels()
+	c.ServeJSON()
+}
+
+// GetLevel 获取关卡
+// @Title 获取关卡
+// @Description 获取关卡的当前版本或指定版本
+// @Param name path string true "关卡名称"
+// @Param version query int false "关卡版本，默认为当前版本"
+// @Success 200 {object} models.Level
+// @Failure 404 {object} ErrorResponse
+// @router /api/levels/:name [get]
+func (c *LevelController) GetLevel() {
+	name := c.Ctx.Input.Param(":name")
+	version, _ := c.GetInt("version")
+
+	utils.RefreshLevel(name)
+	level, ok := models.GetLevelVersion(name, version)
+	if !ok {
+		c.Data["json"] = map[string]string{"error": utils.ErrLevelNotFound.Error()}
+		c.Ctx.Output.Status = http.StatusNotFound
+	} else {
+		c.Data["json"] = level
+	}
+	c.ServeJSON()
+}
+
+// CreateLevel 创建关卡
+// @Title 创建关卡
+// @Description 校验并保存新关卡，版本从1开始，当前玩家成为关卡的创建者；校验失败时返回所有问题
+// @Param Authorization header string true "Bearer 会话令牌"
+// @Param request body LevelRequest true "关卡请求"
+// @Success 200 {object} models.Level
+// @Failure 400 {object} LevelErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @router /api/levels [post]
+func (c *LevelController) CreateLevel() {
+	session, ok := requireSession(&c.Controller)
+	if !ok {
+		return
+	}
+	var req LevelRequest
+	if !c.parseBody(&req) {
+		return
+	}
+	c.saveLevel(req.Name, req.Map, true, session.PlayerID)
+}
+
+// UpdateLevel 修改关卡
+// @Title 修改关卡
+// @Description 校验并保存关卡的新版本，只有创建者可以修改，旧版本上的成绩不会混入新版本的排行榜；校验失败时返回所有问题
+// @Param Authorization header string true "Bearer 会话令牌"
+// @Param name path string true "关卡名称"
+// @Param request body LevelRequest true "关卡请求"
+// @Success 200 {object} models.Level
+// @Failure 400 {object} LevelErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @router /api/levels/:name [put]
+func (c *LevelController) UpdateLevel() {
+	session, ok := requireSession(&c.Controller)
+	if !ok {
+		return
+	}
+	var req LevelRequest
+	if !c.parseBody(&req) {
+		return
+	}
+	c.saveLevel(c.Ctx.Input.Param(":name"), req.Map, false, session.PlayerID)
+}
+
+// DeleteLevel 删除关卡
+// @Title 删除关卡
+// @Description 删除编辑器保存的关卡，只有创建者可以删除，之后不能再用它创建游戏，已有的录像和成绩仍然保留
+// @Param Authorization header string true "Bearer 会话令牌"
+// @Param name path string true "关卡名称"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @router /api/levels/:name [delete]
+func (c *LevelController) DeleteLevel() {
+	session, ok := requireSession(&c.Controller)
+	if !ok {
+		return
+	}
+	name := c.Ctx.Input.Param(":name")
+
+	if err := utils.DeleteLevel(name, session.PlayerID); err != nil {
+		beego.Error("删除关卡失败:", name, err)
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = levelErrorStatus(err)
+	} else {
+		c.Data["json"] = map[string]string{"success": "关卡已删除"}
+	}
+	c.ServeJSON()
+}
+
+// parseBody 解析JSON请求体，失败时写入错误响应并返回false
+func (c *LevelController) parseBody(v interface{}) bool {
+	requestBody, err := io.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		beego.Error("读取请求体失败:", err)
+		c.Data["json"] = map[string]string{"error": "读取请求体失败"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return false
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(requestBody), v); err != nil {
+		c.Data["json"] = map[string]string{"error": "无效的请求格式"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return false
+	}
+	return true
+}
+
+// saveLevel 校验并保存关卡，写入保存后的关卡或错误
+func (c *LevelController) saveLevel(name, data string, create bool, playerID int64) {
+	level, problems := utils.ValidateCustomLevel(name, data)
+	if len(problems) > 0 {
+		c.Data["json"] = LevelErrorResponse{Error: "关卡校验失败", Errors: problems}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return
+	}
+
+	level, err := utils.SaveLevel(level, create, playerID)
+	if err != nil {
+		beego.Error("保存关卡失败:", name, err)
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = levelErrorStatus(err)
+	} else {
+		c.Data["json"] = level
+	}
+	c.ServeJSON()
+}
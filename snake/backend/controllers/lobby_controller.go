@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"blockcade/utils"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/astaxie/beego"
+)
+
+// LobbyController 多人游戏大厅控制器
+type LobbyController struct {
+	beego.Controller
+}
+
+// RoomRequest 创建房间和自动匹配请求结构
+type RoomRequest struct {
+	Mode          string `json:"mode,omitempty"` // 游戏模式，默认为经典模式
+	Size          int    `json:"size"`           // 房间人数
+	PlayerName    string `json:"playerName"`
+	Bots          int    `json:"bots,omitempty"`          // 创建房间时由机器人占据的座位数，自动匹配时忽略
+	BotDifficulty string `json:"botDifficulty,omitempty"` // 机器人难度：easy、normal（默认）或hard
+}
+
+// JoinRoomRequest 加入房间请求结构
+type JoinRoomRequest struct {
+	PlayerName string `json:"playerName"`
+}
+
+// ReadyRequest 准备请求结构
+type ReadyRequest struct {
+	Ready *bool `json:"ready,omitempty"` // 不传时视为准备
+}
+
+// RoomResponse 房间响应结构
+// PlayerToken只在创建、加入或匹配时返回，之后通过X-Player-Token请求头提供；
+// Seat在游戏开始后返回给持有玩家令牌的请求
+type RoomResponse struct {
+	utils.Room
+	PlayerToken string          `json:"playerToken,omitempty"`
+	Seat        *utils.RoomSeat `json:"seat,omitempty"`
+}
+
+// playerTokenHeader 玩家令牌请求头
+const playerTokenHeader = "X-Player-Token"
+
+// lobbyErrorStatus 将大厅返回的错误转换为HTTP状态码
+func lobbyErrorStatus(err error) int {
+	switch err {
+	case utils.ErrRoomNotFound:
+		return http.StatusNotFound
+	case utils.ErrRoomFull:
+		return http.StatusConflict
+	case utils.ErrNotInRoom:
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// parseBody 解析可以为空的JSON请求体，失败时写入错误响应并返回false
+func (c *LobbyController) parseBody(v interface{}) bool {
+	requestBody, err := io.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		beego.Error("读取请求体失败:", err)
+		c.Data["json"] = map[string]string{"error": "读取请求体失败"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return false
+	}
+	if len(bytes.TrimSpace(requestBody)) > 0 {
+		if err := json.Unmarshal(requestBody, v); err != nil {
+			c.Data["json"] = map[string]string{"error": "无效的请求格式"}
+			c.Ctx.Output.Status = http.StatusBadRequest
+			c.ServeJSON()
+			return false
+		}
+	}
+	return true
+}
+
+// player 确定加入房间的玩家名称和注册玩家ID，登录玩家使用玩家的名称；会话令牌无效时写入错误响应并返回false
+func (c *LobbyController) player(name string) (string, int64, bool) {
+	session, ok := requestSession(&c.Controller)
+	if !ok {
+		return "", 0, false
+	}
+	if session != nil {
+		return session.Name, session.PlayerID, true
+	}
+	return name, 0, true
+}
+
+// serveRoom 写入房间响应或错误
+func (c *LobbyController) serveRoom(resp RoomResponse, err error) {
+	if err != nil {
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = lobbyErrorStatus(err)
+	} else {
+		c.Data["json"] = resp
+	}
+	c.ServeJSON()
+}
+
+// CreateRoom 创建房间
+// @Title 创建房间
+// @Description 创建多人游戏房间，创建者自动加入，返回玩家令牌；可以用机器人填充部分座位
+// @Param Authorization header string false "Bearer 会话令牌，登录玩家使用玩家的名称"
+// @Param request body RoomRequest true "创建房间请求"
+// @Success 200 {object} RoomResponse
+// @Failure 400 {object} ErrorResponse
+// @router /api/rooms [post]
+func (c *LobbyController) CreateRoom() {
+	var req RoomRequest
+	if !c.parseBody(&req) {
+		return
+	}
+
+	name, playerID, ok := c.player(req.PlayerName)
+	if !ok {
+		return
+	}
+	room, token, err := utils.GetLobby().CreateRoom(req.Mode, req.Size, name, playerID, req.Bots, req.BotDifficulty)
+	c.serveRoom(RoomResponse{Room: room, PlayerToken: token}, err)
+}
+
+// ListRooms 列出房间
+// @Title 列出房间
+// @Description 列出还有空位的房间
+// @Param mode query string false "只列出该模式的房间"
+// @Success 200 {array} utils.Room
+// @router /api/rooms [get]
+func (c *LobbyController) ListRooms() {
+	c.Data["json"] = utils.GetLobby().ListRooms(c.GetString("mode"))
+	c.ServeJSON()
+}
+
+// GetRoom 获取房间状态
+// @Title 获取房间状态
+// @Description 获取房间的玩家、准备情况和倒计时，游戏开始后持有玩家令牌的请求会得到自己的座位和控制令牌
+// @Param id path string true "房间ID"
+// @Param X-Player-Token header string false "玩家令牌"
+// @Success 200 {object} RoomResponse
+// @Failure 404 {object} ErrorResponse
+// @router /api/rooms/:id [get]
+func (c *LobbyController) GetRoom() {
+	roomID := c.Ctx.Input.Param(":id")
+
+	room, seat, err := utils.GetLobby().GetRoom(roomID, c.Ctx.Input.Header(playerTokenHeader))
+	c.serveRoom(RoomResponse{Room: room, Seat: seat}, err)
+}
+
+// JoinRoom 加入房间
+// @Title 加入房间
+// @Description 加入还有空位的房间，返回玩家令牌
+// @Param id path string true "房间ID"
+// @Param Authorization header string false "Bearer 会话令牌，登录玩家使用玩家的名称"
+// @Param request body JoinRoomRequest false "加入房间请求"
+// @Success 200 {object} RoomResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @router /api/rooms/:id/join [post]
+func (c *LobbyController) JoinRoom() {
+	roomID := c.Ctx.Input.Param(":id")
+
+	var req JoinRoomRequest
+	if !c.parseBody(&req) {
+		return
+	}
+
+	name, playerID, ok := c.player(req.PlayerName)
+	if !ok {
+		return
+	}
+	room, token, err := utils.GetLobby().JoinRoom(roomID, name, playerID)
+	c.serveRoom(RoomResponse{Room: room, PlayerToken: token}, err)
+}
+
+// Ready 设置准备状态
+// @Title 设置准备状态
+// @Description 设置玩家的准备状态，满员且所有玩家都准备后开始倒计时
+// @Param id path string true "房间ID"
+// @Param X-Player-Token header string true "玩家令牌"
+// @Param request body ReadyRequest false "准备请求"
+// @Success 200 {object} RoomResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @router /api/rooms/:id/ready [post]
+func (c *LobbyController) Ready() {
+	roomID := c.Ctx.Input.Param(":id")
+
+	var req ReadyRequest
+	if !c.parseBody(&req) {
+		return
+	}
+	ready := req.Ready == nil || *req.Ready
+
+	room, err := utils.GetLobby().SetReady(roomID, c.Ctx.Input.Header(playerTokenHeader), ready)
+	c.serveRoom(RoomResponse{Room: room}, err)
+}
+
+// LeaveRoom 离开房间
+// @Title 离开房间
+// @Description 离开尚未开始的房间
+// @Param id path string true "房间ID"
+// @Param X-Player-Token header string true "玩家令牌"
+// @Success 200 {object} SuccessResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @router /api/rooms/:id/leave [post]
+func (c *LobbyController) LeaveRoom() {
+	roomID := c.Ctx.Input.Param(":id")
+
+	if err := utils.GetLobby().LeaveRoom(roomID, c.Ctx.Input.Header(playerTokenHeader)); err != nil {
+		c.Data["json"] = map[string]string{"error": err.Error()}
+		c.Ctx.Output.Status = lobbyErrorStatus(err)
+	} else {
+		c.Data["json"] = map[string]string{"success": "已离开房间"}
+	}
+	c.ServeJSON()
+}
+
+// Match 自动匹配
+// @Title 自动匹配
+// @Description 按模式和人数加入有空位的房间，没有时创建新房间
+// @Param Authorization header string false "Bearer 会话令牌，登录玩家使用玩家的名称"
+// @Param request body RoomRequest true "匹配请求"
+// @Success 200 {object} RoomResponse
+// @Failure 400 {object} ErrorResponse
+// @router /api/rooms/match [post]
+func (c *LobbyController) Match() {
+	var req RoomRequest
+	if !c.parseBody(&req) {
+		return
+	}
+
+	name, playerID, ok := c.player(req.PlayerName)
+	if !ok {
+		return
+	}
+	room, token, err := utils.GetLobby().Match(req.Mode, req.Size, name, playerID)
+	c.serveRoom(RoomResponse{Room: room, PlayerToken: token}, err)
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"blockcade/utils"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego"
+)
+
+// PlayerController 玩家账号控制器
+type PlayerController struct {
+	beego.Controller
+}
+
+// PlayerRequest 注册和登录请求结构
+type PlayerRequest struct {
+	Name        string   `json:"name"`
+	Password    string   `json:"password"`
+	ClaimTokens []string `json:"claimTokens,omitempty"` // 注册时认领的游客成绩，为保存成绩时返回的认领令牌
+}
+
+// ClaimRequest 认领成绩请求结构
+type ClaimRequest struct {
+	ClaimTokens []string `json:"claimTokens"`
+}
+
+// SessionResponse 注册和登录响应结构
+type SessionResponse struct {
+	Player       *utils.Player `json:"player"`
+	SessionToken string        `json:"sessionToken"` // 之后通过Authorization: Bearer请求头提供
+	ExpiresAt    time.Time     `json:"expiresAt"`
+	Claimed      int           `json:"claimed"` // 认领的游客成绩数
+}
+
+// ClaimResponse 认领成绩响应结构
+type ClaimResponse struct {
+	Claimed int `json:"claimed"`
+}
+
+// playerErrorStatus 将玩家账号返回的错误转换为HTTP状态码
+func playerErrorStatus(err error) int {
+	switch err {
+	case utils.ErrInvalidPlayerName, utils.ErrWeakPassword:
+		return http.StatusBadRequest
+	case utils.ErrInvalidCredentials, utils.ErrInvalidSession:
+		return http.StatusUnauthorized
+	case utils.ErrPlayerExists:
+		return http.StatusConflict
+	case utils.ErrAccountsUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// requestSession 读取Authorization: Bearer请求头中的会话令牌
+// 没有令牌时返回nil，表示游客；令牌无效时写入错误响应并返回false
+func requestSession(c *beego.Controller) (*utils.Session, bool) {
+	header := c.Ctx.Input.Header("Authorization")
+	if header == "" {
+		return nil, true
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if ok {
+		session, err := utils.ParseSessionToken(strings.TrimSpace(token))
+		if err == nil {
+			return session, true
+		}
+	}
+	c.Data["json"] = map[string]string{"error": utils.ErrInvalidSession.Error()}
+	c.Ctx.Output.Status = http.StatusUnauthorized
+	c.ServeJSON()
+	return nil, false
+}
+
+// requireSession 读取会话令牌，没有登录时写入错误响应并返回false
+func requireSession(c *beego.Controller) (*utils.Session, bool) {
+	session, ok := requestSession(c)
+	if !ok {
+		return nil, false
+	}
+	if session == nil {
+		c.Data["json"] = map[string]string{"error": "请先登录"}
+		c.Ctx.Output.Status = http.StatusUnauthorized
+		c.ServeJSON()
+		return nil, false
+	}
+	return session, true
+}
+
+// sessionPlayerID 会话对应的玩家ID，游客为0
+func sessionPlayerID(session *utils.Session) int64 {
+	if session == nil {
+		return 0
+	}
+	return session.PlayerID
+}
+
+// Register 注册玩家
+// @Title 注册玩家
+// @Description 注册玩家账号并登录，可以同时认领之前以游客身份保存的成绩
+// @Param request body PlayerRequest true "注册请求"
+// @Success 200 {object} SessionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @router /api/players/register [post]
+func (c *PlayerController) Register() {
+	var req PlayerRequest
+	if !c.parseBody(&req) {
+		return
+	}
+
+	player, err := utils.RegisterPlayer(req.Name, req.Password)
+	if err != nil {
+		c.serveError("注册失败:", err)
+		return
+	}
+
+	// 认领失败不影响注册，登录后可以再次认领
+	claimed, err := utils.ClaimRecords(player.ID, player.Name, req.ClaimTokens)
+	if err != nil {
+		beego.Error("认领成绩失败:", player.ID, err)
+	}
+	c.serveSession(player, claimed)
+}
+
+// Login 登录
+// @Title 登录
+// @Description 校验玩家名称和密码，返回会话令牌
+// @Param request body PlayerRequest true "登录请求"
+// @Success 200 {object} SessionResponse
+// @Failure 401 {object} ErrorResponse
+// @router /api/players/login [post]
+func (c *PlayerController) Login() {
+	var req PlayerRequest
+	if !c.parseBody(&req) {
+		return
+	}
+
+	player, err := utils.AuthenticatePlayer(req.Name, req.Password)
+	if err != nil {
+		c.serveError("登录失败:", err)
+		return
+	}
+	c.serveSession(player, 0)
+}
+
+// GetMe 获取当前玩家
+// @Title 获取当前玩家
+// @Description 获取会话令牌对应的玩家
+// @Param Authorization header string true "Bearer 会话令牌"
+// @Success 200 {object} utils.Player
+// @Failure 401 {object} ErrorResponse
+// @router /api/players/me [get]
+func (c *PlayerController) GetMe() {
+	session, ok := requireSession(&c.Controller)
+	if !ok {
+		return
+	}
+
+	player, err := utils.GetPlayer(session.PlayerID)
+	if err != nil {
+		c.serveError("获取玩家失败:", err)
+		return
+	}
+	c.Data["json"] = player
+	c.ServeJSON()
+}
+
+// ClaimRecords 认领成绩
+// @Title 认领成绩
+// @Description 把以游客身份保存的成绩归到当前玩家名下
+// @Param Authorization header string true "Bearer 会话令牌"
+// @Param request body ClaimRequest true "认领请求"
+// @Success 200 {object} ClaimResponse
+// @Failure 401 {object} ErrorResponse
+// @router /api/players/claim [post]
+func (c *PlayerController) ClaimRecords() {
+	session, ok := requireSession(&c.Controller)
+	if !ok {
+		return
+	}
+	var req ClaimRequest
+	if !c.parseBody(&req) {
+		return
+	}
+
+	claimed, err := utils.ClaimRecords(session.PlayerID, session.Name, req.ClaimTokens)
+	if err != nil {
+		c.serveError("认领成绩失败:", err)
+		return
+	}
+	c.Data["json"] = ClaimResponse{Claimed: claimed}
+	c.ServeJSON()
+}
+
+// parseBody 解析JSON请求体，失败时写入错误响应并返回false
+func (c *PlayerController) parseBody(v interface{}) bool {
+	requestBody, err := io.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		beego.Error("读取请求体失败:", err)
+		c.Data["json"] = map[string]string{"error": "读取请求体失败"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return false
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(requestBody), v); err != nil {
+		c.Data["json"] = map[string]string{"error": "无效的请求格式"}
+		c.Ctx.Output.Status = http.StatusBadRequest
+		c.ServeJSON()
+		return false
+	}
+	return true
+}
+
+// serveSession 为玩家签发会话令牌并写入响应
+func (c *PlayerController) serveSession(player *utils.Player, claimed int) {
+	token, session := utils.IssueSessionToken(player)
+	c.Data["json"] = SessionResponse{Player: player, SessionToken: token, ExpiresAt: session.ExpiresAt, Claimed: claimed}
+	c.ServeJSON()
+}
+
+// serveError 写入错误响应，未预期的错误只记录日志，不返回细节
+func (c *PlayerController) serveError(message string, err error) {
+	status := playerErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		beego.Error(message, err)
+		c.Data["json"] = map[string]string{"error": "服务器内部错误"}
+	} else {
+		c.Data["json"] = map[string]string{"error": err.Error()}
+	}
+	c.Ctx.Output.Status = status
+	c.ServeJSON()
+}
@@ -3,30 +3,84 @@ package main
 import (
 	"blockcade/routers"
 	"blockcade/utils"
+	"context"
+	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/astaxie/beego"
 )
 
 func main() {
+	rebuildLeaderboards := flag.Bool("rebuild-leaderboards", false, "从数据库重建Redis中的排行榜后退出")
+	flag.Parse()
+
 	// 初始化数据库连接
 	utils.InitDB()
-	defer utils.CloseDB()
 
 	// 初始化Redis连接
 	utils.InitRedis()
-	defer utils.CloseRedis()
 
-	// 初始化游戏管理器
+	if *rebuildLeaderboards {
+		err := utils.RebuildLeaderboards()
+		utils.CloseDB()
+		utils.CloseRedis()
+		if err != nil {
+			log.Fatalf("Failed to rebuild leaderboards: %v\n", err)
+		}
+		return
+	}
+
+	// Redis中还没有排行榜时从数据库生成
+	utils.InitLeaderboards()
+
+	// 加载关卡地图
+	utils.InitLevels()
+
+	// 初始化游戏管理器并启动游戏更新循环
 	gameManager := utils.GetGameManager()
 	if gameManager == nil {
 		log.Fatal("Failed to initialize game manager")
 	}
+	gameManager.Start()
 
 	// 初始化路由
 	routers.InitRouter()
 
 	// 启动服务器
 	log.Println("Server starting on port", beego.AppConfig.String("httpport"))
-	beego.Run()
+	go beego.Run()
+
+	// 等待退出信号
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	log.Println("Received", sig, "shutting down")
+
+	shutdown(gameManager)
+}
+
+// shutdown 按顺序优雅关闭服务
+func shutdown(gameManager *utils.GameManager) {
+	// 1. 停止游戏更新，游戏时间不再推进
+	gameManager.Stop()
+
+	// 2. 停止接收新请求，等待处理中的请求完成
+	timeout := time.Duration(beego.AppConfig.DefaultInt("shutdown.timeout", 10)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := beego.BeeApp.Server.Shutdown(ctx); err != nil {
+		log.Printf("Failed to shut down HTTP server gracefully: %v\n", err)
+	}
+
+	// 3. 保存进行中的游戏
+	gameManager.Flush()
+
+	// 4. 关闭数据库和Redis连接
+	utils.CloseDB()
+	utils.CloseRedis()
+	log.Println("Server stopped")
 }
@@ -0,0 +1,138 @@
+package models
+
+import "math/rand"
+
+// 机器人难度
+const (
+	BotEasy   = "easy"
+	BotNormal = "normal"
+	BotHard   = "hard"
+)
+
+// BotDifficulty 机器人难度参数
+type BotDifficulty struct {
+	LookAhead   int     // 寻找食物时的最大搜索步数，0表示不限
+	MistakeRate float64 // 每次决策时随机选择方向的概率
+}
+
+// botDifficulties 各难度的参数
+var botDifficulties = map[string]BotDifficulty{
+	BotEasy:   {LookAhead: 4, MistakeRate: 0.15},
+	BotNormal: {LookAhead: 12, MistakeRate: 0.05},
+	BotHard:   {LookAhead: 0, MistakeRate: 0},
+}
+
+// IsValidBotDifficulty 判断机器人难度是否有效
+func IsValidBotDifficulty(difficulty string) bool {
+	_, ok := botDifficulties[difficulty]
+	return ok
+}
+
+// opposite 返回相反方向
+func opposite(d Direction) Direction {
+	switch d {
+	case Up:
+		return Down
+	case Down:
+		return Up
+	case Left:
+		return Right
+	}
+	return Left
+}
+
+// AddBot 让机器人占据第一条还没有玩家的蛇，返回蛇ID
+// 所有蛇都有玩家后游戏开始；没有空位时返回false
+func (g *Game) AddBot(difficulty string) (int, bool) {
+	if !IsValidBotDifficulty(difficulty) {
+		difficulty = BotNormal
+	}
+	for _, snake := range g.Snakes {
+		if snake.Joined {
+			continue
+		}
+		snake.Joined = true
+		snake.Bot = difficulty
+		if g.full() {
+			g.Start()
+		}
+		return snake.ID, true
+	}
+	return 0, false
+}
+
+// BotDirection 为机器人控制的蛇选择下一步的方向
+// 在难度允许的步数内朝食物寻路，并避开墙体、蛇身和其他蛇头可能到达的格子；
+// 找不到路径时选择可活动空间最大的方向。rng用于模拟失误，不使用游戏自身的随机数
+func (g *Game) BotDirection(snakeID int, rng *rand.Rand) (Direction, bool) {
+	snake := g.Snake(snakeID)
+	if g.Status != GameStatusRunning || snake == nil || !snake.Alive || snake.Bot == "" {
+		return 0, false
+	}
+	difficulty := botDifficulties[snake.Bot]
+	head := snake.Head()
+
+	// 可选方向：不能掉头
+	var candidates []Direction
+	for _, d := range directions {
+		if d != opposite(snake.Direction) {
+			candidates = append(candidates, d)
+		}
+	}
+
+	// 按难度随机失误
+	if rng.Float64() < difficulty.MistakeRate {
+		return candidates[rng.Intn(len(candidates))], true
+	}
+
+	board := newGrid(g)
+
+	// 其他蛇头下一步可能到达的格子，走进去可能迎头相撞
+	contested := make(map[Position]bool)
+	for _, other := range g.aliveSnakes() {
+		if other.ID == snakeID {
+			continue
+		}
+		for _, d := range directions {
+			contested[other.Head().Move(d)] = true
+		}
+	}
+
+	var safe, risky []Direction
+	for _, d := range candidates {
+		next := head.Move(d)
+		if !board.free(next) {
+			continue
+		}
+		if contested[next] {
+			risky = append(risky, d)
+		} else {
+			safe = append(safe, d)
+		}
+	}
+	if len(safe) == 0 {
+		safe = risky
+	}
+	if len(safe) == 0 {
+		// 无路可走
+		return snake.Direction, true
+	}
+
+	// 朝食物走，但要保证走过去后还有足够的活动空间
+	need := len(snake.Body) + 1
+	if d, ok := board.pathTo(head, g.Food.Position, safe, difficulty.LookAhead); ok {
+		if board.area(head.Move(d), need) >= need {
+			return d, true
+		}
+	}
+
+	// 选择活动空间最大的方向，相同时优先保持当前方向
+	best, bestArea := safe[0], -1
+	for _, d := range safe {
+		area := board.area(head.Move(d), g.Width*g.Height)
+		if area > bestArea || (area == bestArea && d == snake.Direction) {
+			best, bestArea = d, area
+		}
+	}
+	return best, true
+}
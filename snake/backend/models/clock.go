@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Clock 游戏时钟，游戏内所有与时间相关的规则都通过它读取当前时间
+type Clock interface {
+	// Now 返回当前游戏时间
+	Now() time.Time
+	// Advance 在每次游戏更新开始时调用，d为本次更新对应的时长
+	Advance(d time.Duration)
+}
+
+// RealClock 使用系统时间的时钟
+type RealClock struct{}
+
+// Now 返回系统当前时间
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// Advance 系统时间自行流逝，无需处理
+func (RealClock) Advance(time.Duration) {}
+
+// TickClock 按更新推进的时钟，每次更新前进该次更新的间隔
+// 游戏时间只取决于更新次数和间隔，便于测试、快进和复现
+type TickClock struct {
+	now time.Time
+}
+
+// NewTickClock 创建一个从start开始的时钟
+func NewTickClock(start time.Time) *TickClock {
+	return &TickClock{now: start}
+}
+
+// Now 返回当前游戏时间
+func (c *TickClock) Now() time.Time {
+	return c.now
+}
+
+// Advance 前进d
+func (c *TickClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTickClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		advance []time.Duration
+		want    time.Time
+	}{
+		{"不推进", nil, start},
+		{"推进一次", []time.Duration{100 * time.Millisecond}, start.Add(100 * time.Millisecond)},
+		{"多次推进累计", []time.Duration{150 * time.Millisecond, 150 * time.Millisecond, 700 * time.Millisecond}, start.Add(time.Second)},
+		{"推进0不变", []time.Duration{0, 0}, start},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewTickClock(start)
+			for _, d := range tt.advance {
+				clock.Advance(d)
+			}
+			if got := clock.Now(); !got.Equal(tt.want) {
+				t.Errorf("Now() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// 游戏事件类型
+const (
+	EventGameStarted   = "game_started"   // 游戏开始
+	EventFoodEaten     = "food_eaten"     // 蛇吃到食物
+	EventWallSpawned   = "wall_spawned"   // 生成墙体
+	EventWallExpired   = "wall_expired"   // 墙体消失
+	EventDied          = "died"           // 蛇死亡，Cause为死亡原因
+	EventGameEnded     = "game_ended"     // 游戏结束
+	EventPowerUp       = "power_up"       // 蛇吃到特殊食物，Effect为食物类型
+	EventEffectExpired = "effect_expired" // 效果到期，Effect为效果类型
+	EventGamePaused    = "game_paused"    // 游戏暂停，SnakeID为发起暂停的蛇
+	EventGameResumed   = "game_resumed"   // 游戏继续，SnakeID为发起继续的蛇，自动继续时为NoSnake
+)
+
+// 死亡原因
+const (
+	DeathBoundary   = "boundary"   // 撞到边界
+	DeathWall       = "wall"       // 撞到墙体
+	DeathSelf       = "self"       // 撞到自己
+	DeathSnake      = "snake"      // 撞到其他蛇的身体
+	DeathHeadOn     = "head_on"    // 与其他蛇迎头相撞
+	DeathStarvation = "starvation" // 超过模式规定的时间没有吃到食物
+)
+
+// EndTimeUp 限时模式时间用完，作为游戏结束事件的Cause
+const EndTimeUp = "time_up"
+
+// NoSnake 事件与具体的蛇无关时SnakeID的取值
+const NoSnake = -1
+
+// maxRecentEvents 游戏状态中保留的最近事件数量
+const maxRecentEvents = 32
+
+// Event 游戏事件
+type Event struct {
+	Tick     int64     `json:"tick"` // 事件发生时游戏已执行的更新次数
+	Type     string    `json:"type"`
+	SnakeID  int       `json:"snakeId"`            // 相关的蛇ID，与蛇无关时为NoSnake
+	Position *Position `json:"position,omitempty"` // 相关的位置
+	Cause    string    `json:"cause,omitempty"`    // 死亡原因
+	Effect   string    `json:"effect,omitempty"`   // 特殊食物或效果的类型
+	Time     time.Time `json:"time"`               // 游戏时钟时间
+}
+
+// emit 记录游戏事件，只保留最近的maxRecentEvents个
+func (g *Game) emit(event Event) {
+	event.Tick = g.Tick
+	event.Time = g.clock.Now()
+	g.Events = append(g.Events, event)
+	if len(g.Events) > maxRecentEvents {
+		g.Events = append([]Event(nil), g.Events[len(g.Events)-maxRecentEvents:]...)
+	}
+}
+
+// kill 让蛇死亡并记录死亡原因
+func (g *Game) kill(snake *Snake, cause string) {
+	snake.Alive = false
+	snake.DeathCause = cause
+	g.DeathCause = cause
+	head := snake.Head()
+	g.emit(Event{Type: EventDied, SnakeID: snake.ID, Position: &head, Cause: cause})
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"math/rand"
 	"time"
 )
@@ -15,21 +16,62 @@ const (
 	Right
 )
 
+// directions 所有移动方向
+var directions = []Direction{Up, Down, Left, Right}
+
 // Position 位置坐标
 type Position struct {
 	X int `json:"x"`
 	Y int `json:"y"`
 }
 
+// Move 返回沿方向移动一格后的位置
+func (p Position) Move(d Direction) Position {
+	switch d {
+	case Up:
+		p.Y--
+	case Down:
+		p.Y++
+	case Left:
+		p.X--
+	case Right:
+		p.X++
+	}
+	return p
+}
+
 // Snake 蛇的结构
 type Snake struct {
-	Body      []Position `json:"body"`
-	Direction Direction  `json:"direction"`
+	ID           int         `json:"id"`
+	Body         []Position  `json:"body"`
+	Direction    Direction   `json:"direction"`
+	Alive        bool        `json:"alive"`
+	Joined       bool        `json:"joined"`             // 是否已有玩家加入
+	Bot          string      `json:"bot,omitempty"`      // 机器人难度，为空表示由玩家控制
+	PlayerID     int64       `json:"playerId,omitempty"` // 控制这条蛇的注册玩家ID，游客为0
+	Score        int         `json:"score"`
+	FoodCount    int         `json:"foodCount"`
+	Time         int         `json:"time"` // 存活时间（秒）
+	LastFoodTime time.Time   `json:"lastFoodTime"`
+	Recorded     bool        `json:"recorded"`               // 是否已提交过成绩记录
+	DeathCause   string      `json:"deathCause,omitempty"`   // 死亡原因，时间用完时存活的蛇为EndTimeUp
+	Bonus        int         `json:"bonus"`                  // 双倍得分期间额外获得的分数
+	Effects      []Effect    `json:"effects,omitempty"`      // 正在生效的效果及剩余时长
+	PendingTurns []Direction `json:"pendingTurns,omitempty"` // 尚未生效的转向，每次更新最多生效一个
+	Pauses       int         `json:"pauses"`                 // 已发起的暂停次数
+
+	controlTokenHash string // 控制令牌的摘要
+}
+
+// Head 返回蛇头位置
+func (s *Snake) Head() Position {
+	return s.Body[0]
 }
 
 // Food 食物结构
 type Food struct {
 	Position Position `json:"position"`
+	Type     string   `json:"type"` // 食物类型，特殊食物被吃到后产生效果
 }
 
 // Wall 墙体结构
@@ -37,77 +79,295 @@ type Wall struct {
 	Position  Position  `json:"position"`
 	CreatedAt time.Time `json:"created_at"`
 	Lifetime  int       // 存活时间（秒）
+	Permanent bool      `json:"permanent,omitempty"` // 关卡中的永久墙体，不会消失
 }
 
 // 游戏状态常量
 const (
-	GameStatusRunning = "running" // 游戏运行中
-	GameStatusEnded   = "ended"   // 游戏结束
+	GameStatusWaiting   = "waiting"   // 等待玩家加入
+	GameStatusCountdown = "countdown" // 开始或继续前的倒计时，蛇不移动
+	GameStatusRunning   = "running"   // 游戏运行中
+	GameStatusPaused    = "paused"    // 游戏暂停，游戏时钟和所有计时都停止
+	GameStatusEnded     = "ended"     // 游戏结束
+)
+
+// MaxPlayers 一局游戏最多容纳的玩家数
+const MaxPlayers = 4
+
+// NoWinner 没有胜者时Winner的取值
+const NoWinner = -1
+
+// 棋盘边长范围，关卡和自定义棋盘大小都不能超出
+const (
+	MinBoardSize = 5
+	MaxBoardSize = 50
 )
 
 // Game 游戏结构体
+// 单人游戏只有一条蛇，多人游戏中每位玩家控制一条蛇，最后存活的蛇获胜
 type Game struct {
-	ID             string    `json:"id"`
-	Snake          Snake     `json:"snake"`
-	Food           Food      `json:"food"`
-	Walls          []Wall    `json:"walls"`
-	Width          int       `json:"width"`
-	Height         int       `json:"height"`
-	Status         string    `json:"status"`
-	Score          int       `json:"score"`
-	FoodCount      int       `json:"foodCount"`
-	Time           int       `json:"time"`
-	LastFoodTime   time.Time `json:"lastFoodTime"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
-	LastUpdateTime time.Time `json:"lastUpdateTime"` // 上一次更新时间，用于计算时间差
-	MaxWalls       int       `json:"maxWalls"`
+	ID               string     `json:"id"`
+	Snakes           []*Snake   `json:"snakes"`
+	Food             Food       `json:"food"`
+	Walls            []Wall     `json:"walls"`
+	Width            int        `json:"width"`
+	Height           int        `json:"height"`
+	Status           string     `json:"status"`
+	Score            int        `json:"score"`     // 单人游戏为蛇的分数，多人游戏为最高分
+	FoodCount        int        `json:"foodCount"` // 所有蛇吃到的豆子总数
+	Time             int        `json:"time"`
+	Winner           int        `json:"winner"`               // 多人游戏中获胜的蛇ID，没有胜者时为NoWinner
+	DeathCause       string     `json:"deathCause,omitempty"` // 最近一条死亡的蛇的死亡原因，单人游戏即结束原因；时间用完时为EndTimeUp
+	Events           []Event    `json:"events"`               // 最近的游戏事件
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+	LastUpdateTime   time.Time  `json:"lastUpdateTime"` // 上一次更新时间，用于计算时间差
+	LastActivityAt   time.Time  `json:"lastActivityAt"` // 玩家最后一次操作或读取的系统时间，用于判断游戏是否过期
+	MaxWalls         int        `json:"maxWalls"`
+	Seed             int64      `json:"seed"`                   // 随机种子，相同种子和操作可复现同一局游戏
+	CustomSeed       bool       `json:"customSeed,omitempty"`   // 种子由客户端指定，结果可以预先演练，不计入排行榜
+	Tick             int64      `json:"tick"`                   // 已执行的更新次数
+	Mode             string     `json:"mode"`                   // 游戏模式
+	Level            string     `json:"level,omitempty"`        // 关卡名称，为空表示空白棋盘
+	LevelVersion     int        `json:"levelVersion,omitempty"` // 关卡版本
+	FoodZone         []Position `json:"foodZone,omitempty"`     // 食物生成区域，为空时食物可以生成在任意空地
+	BaseTickInterval int        `json:"baseTickInterval"`       // 初始更新间隔（毫秒）
+	TickInterval     int        `json:"tickInterval"`           // 当前更新间隔（毫秒），客户端可据此插值
+	StartCountdown   int        `json:"startCountdown"`         // 开始前的倒计时（秒），0表示立即开始
+	Countdown        int        `json:"countdown"`              // 倒计时剩余时长（毫秒）
+	PausedBy         int        `json:"pausedBy"`               // 发起暂停的蛇ID，没有暂停时为NoSnake
+	PausedAt         time.Time  `json:"pausedAt"`               // 暂停时的系统时间，用于限制暂停时长
+
+	src    *countingSource // 随机数源，记录已取用次数以便恢复
+	rng    *rand.Rand      // 本局游戏独立的随机数生成器
+	clock  Clock           // 游戏时钟
+	inputs []ReplayInput   // 被接受的方向变化，用于录像回放
+}
+
+// maxSeed 随机种子上限，保证种子在JavaScript中可以精确表示
+const maxSeed = 1 << 53
+
+// NewSeed 生成一个新的随机种子
+func NewSeed() int64 {
+	return rand.Int63n(maxSeed)
+}
+
+// IsValidSeed 判断种子是否在[0, 2^53)范围内
+func IsValidSeed(seed int64) bool {
+	return seed >= 0 && seed < maxSeed
+}
+
+// GameOptions 创建游戏的参数，相同参数和输入可以复现同一局游戏
+type GameOptions struct {
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	MaxWalls     int    `json:"maxWalls"`
+	Seed         int64  `json:"seed"`
+	CustomSeed   bool   `json:"customSeed"` // 种子由客户端指定
+	Mode         string `json:"mode"`
+	TickInterval int    `json:"tickInterval"` // 初始更新间隔（毫秒）
+	Players      int    `json:"players"`      // 玩家数量，多人游戏在所有玩家加入后开始
+	Countdown    int    `json:"countdown"`    // 开始前的倒计时（秒），0表示立即开始
+	Level        string `json:"level"`        // 关卡名称，指定时棋盘大小由关卡决定
+	LevelVersion int    `json:"levelVersion"` // 关卡版本，为0时使用当前版本
 }
 
 // NewGame 创建一个新游戏
-func NewGame(id string, width, height, maxWalls int) *Game {
-	snake := Snake{
-		Body: []Position{
-			{X: width / 2, Y: height / 2},
-			{X: width/2 - 1, Y: height / 2},
-			{X: width/2 - 2, Y: height / 2},
-		},
-		Direction: Right,
+// clock为nil时使用系统时间
+func NewGame(id string, opts GameOptions, clock Clock) *Game {
+	if clock == nil {
+		clock = RealClock{}
+	}
+	if !IsValidMode(opts.Mode) {
+		opts.Mode = GameModeClassic
+	}
+	if opts.Players < 1 {
+		opts.Players = 1
+	}
+	if opts.Players > MaxPlayers {
+		opts.Players = MaxPlayers
 	}
 
-	now := time.Now()
+	// 按关卡确定棋盘大小和出生点
+	level, ok := GetLevelVersion(opts.Level, opts.LevelVersion)
+	if !ok {
+		level, opts.Level, opts.LevelVersion = nil, "", 0
+	}
+	var spawns []Spawn
+	if level != nil {
+		opts.LevelVersion = level.Version
+		opts.Width, opts.Height = level.Width, level.Height
+		if opts.Players > len(level.Spawns) {
+			opts.Players = len(level.Spawns)
+		}
+		spawns = level.Spawns[:opts.Players]
+	} else {
+		spawns = defaultSpawns(opts.Width, opts.Height, opts.Players)
+	}
+
+	now := clock.Now()
 	game := &Game{
-		ID:             id,
-		Snake:          snake,
-		Width:          width,
-		Height:         height,
-		Status:         GameStatusRunning,
-		Score:          0,
-		FoodCount:      0,
-		Time:           0,
-		LastFoodTime:   now,
-		CreatedAt:      now,
-		UpdatedAt:      now,
-		LastUpdateTime: now,
-		MaxWalls:       maxWalls,
+		ID:               id,
+		Width:            opts.Width,
+		Height:           opts.Height,
+		Status:           GameStatusWaiting,
+		Score:            0,
+		FoodCount:        0,
+		Time:             0,
+		Winner:           NoWinner,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		LastUpdateTime:   now,
+		MaxWalls:         opts.MaxWalls,
+		Seed:             opts.Seed,
+		CustomSeed:       opts.CustomSeed,
+		Mode:             opts.Mode,
+		Level:            opts.Level,
+		LevelVersion:     opts.LevelVersion,
+		BaseTickInterval: opts.TickInterval,
+		TickInterval:     opts.TickInterval,
+		StartCountdown:   opts.Countdown,
+		PausedBy:         NoSnake,
+		clock:            clock,
+	}
+	game.setRandSource(newCountingSource(opts.Seed, 0))
+	game.spawnSnakes(spawns)
+	if level != nil {
+		for _, pos := range level.Walls {
+			game.Walls = append(game.Walls, Wall{Position: pos, CreatedAt: now, Permanent: true})
+		}
+		game.FoodZone = level.FoodZone
 	}
 
 	// 生成初始食物
 	game.GenerateFood()
 
+	// 单人游戏直接开始
+	if len(game.Snakes) == 1 {
+		game.Start()
+	}
+
 	return game
 }
 
+// defaultSpawns 空白棋盘上按玩家数量安排的出生点
+// 各条蛇分布在均分的行上，头部位于中间列，偶数编号向右、奇数编号向左
+func defaultSpawns(width, height, players int) []Spawn {
+	spawns := make([]Spawn, players)
+	for i := range spawns {
+		direction := Right
+		if i%2 == 1 {
+			direction = Left
+		}
+		spawns[i] = Spawn{
+			Position:  Position{X: width / 2, Y: (i + 1) * height / (players + 1)},
+			Direction: direction,
+		}
+	}
+	return spawns
+}
+
+// spawnSnakes 在出生点放置初始的蛇
+func (g *Game) spawnSnakes(spawns []Spawn) {
+	now := g.clock.Now()
+	g.Snakes = make([]*Snake, len(spawns))
+	for i, spawn := range spawns {
+		g.Snakes[i] = &Snake{
+			ID:           i,
+			Body:         spawn.Body(),
+			Direction:    spawn.Direction,
+			Alive:        true,
+			LastFoodTime: now,
+		}
+	}
+}
+
+// Start 开始等待中的游戏，设置了开始倒计时的游戏先进入倒计时
+func (g *Game) Start() {
+	if g.Status != GameStatusWaiting {
+		return
+	}
+
+	now := g.clock.Now()
+	g.Status = GameStatusRunning
+	if g.StartCountdown > 0 {
+		g.Status = GameStatusCountdown
+		g.Countdown = g.StartCountdown * 1000
+	}
+	g.LastUpdateTime = now
+	for _, snake := range g.Snakes {
+		snake.LastFoodTime = now
+	}
+	g.emit(Event{Type: EventGameStarted, SnakeID: NoSnake})
+}
+
+// Options 返回创建本局游戏所用的参数
+func (g *Game) Options() GameOptions {
+	return GameOptions{
+		Width:        g.Width,
+		Height:       g.Height,
+		MaxWalls:     g.MaxWalls,
+		Seed:         g.Seed,
+		CustomSeed:   g.CustomSeed,
+		Mode:         g.Mode,
+		TickInterval: g.BaseTickInterval,
+		Players:      len(g.Snakes),
+		Level:        g.Level,
+		LevelVersion: g.LevelVersion,
+		Countdown:    g.StartCountdown,
+	}
+}
+
+// Clone 复制游戏的当前状态，副本与原游戏不共享蛇
+func (g *Game) Clone() Game {
+	clone := *g
+	clone.Snakes = make([]*Snake, len(g.Snakes))
+	for i, snake := range g.Snakes {
+		copied := *snake
+		copied.Body = append([]Position{}, snake.Body...)
+		copied.Effects = append([]Effect(nil), snake.Effects...)
+		copied.PendingTurns = append([]Direction(nil), snake.PendingTurns...)
+		clone.Snakes[i] = &copied
+	}
+	clone.Walls = append([]Wall(nil), g.Walls...)
+	clone.Events = append([]Event(nil), g.Events...)
+	return clone
+}
+
+// IsMultiplayer 是否为多人游戏
+func (g *Game) IsMultiplayer() bool {
+	return len(g.Snakes) > 1
+}
+
+// Snake 返回指定ID的蛇，不存在时返回nil
+func (g *Game) Snake(id int) *Snake {
+	if id < 0 || id >= len(g.Snakes) {
+		return nil
+	}
+	return g.Snakes[id]
+}
+
+// aliveSnakes 返回所有存活的蛇
+func (g *Game) aliveSnakes() []*Snake {
+	var alive []*Snake
+	for _, snake := range g.Snakes {
+		if snake.Alive {
+			alive = append(alive, snake)
+		}
+	}
+	return alive
+}
+
 // GenerateFood 生成新食物
 func (g *Game) GenerateFood() {
-	rand.Seed(time.Now().UnixNano())
-
 	// 找到所有可用的位置
 	usedPositions := make(map[Position]bool)
 
 	// 添加蛇的位置
-	for _, pos := range g.Snake.Body {
-		usedPositions[pos] = true
+	for _, snake := range g.aliveSnakes() {
+		for _, pos := range snake.Body {
+			usedPositions[pos] = true
+		}
 	}
 
 	// 添加墙体的位置
@@ -115,39 +375,78 @@ func (g *Game) GenerateFood() {
 		usedPositions[wall.Position] = true
 	}
 
-	// 收集所有可用位置
+	// 优先收集食物生成区域中的可用位置
 	availablePositions := []Position{}
-	for x := 0; x < g.Width; x++ {
-		for y := 0; y < g.Height; y++ {
-			pos := Position{X: x, Y: y}
-			if !usedPositions[pos] {
-				availablePositions = append(availablePositions, pos)
+	for _, pos := range g.FoodZone {
+		if !usedPositions[pos] {
+			availablePositions = append(availablePositions, pos)
+		}
+	}
+
+	// 没有区域或区域已被占满时收集所有可用位置
+	if len(availablePositions) == 0 {
+		for x := 0; x < g.Width; x++ {
+			for y := 0; y < g.Height; y++ {
+				pos := Position{X: x, Y: y}
+				if !usedPositions[pos] {
+					availablePositions = append(availablePositions, pos)
+				}
 			}
 		}
 	}
 
 	if len(availablePositions) > 0 {
 		// 随机选择一个可用位置
-		randomIndex := rand.Intn(len(availablePositions))
+		randomIndex := g.rng.Intn(len(availablePositions))
 		g.Food.Position = availablePositions[randomIndex]
-		g.LastFoodTime = time.Now()
+		g.Food.Type = g.randomFoodType()
 	}
 }
 
+// maxWallAttempts 每次生成墙体最多检查的候选位置数，都不合格时本次不生成，保证检查的开销有上限
+const maxWallAttempts = 8
+
+// baseBoardArea 墙体密度以15x15棋盘为基准，更大或更小的棋盘按面积缩放
+const baseBoardArea = 15 * 15
+
+// ScaleMaxWalls 按棋盘面积缩放墙体数量上限，base为15x15棋盘上的上限，结果至少为1
+func ScaleMaxWalls(base, width, height int) int {
+	scaled := int(math.Round(float64(base*width*height) / baseBoardArea))
+	if scaled < 1 {
+		scaled = 1
+	}
+	return scaled
+}
+
+// wallChance 每次更新生成墙体的概率，与棋盘面积成正比，使墙体密度保持一致；
+// 墙体加速的模式中随游戏时间增加
+func (g *Game) wallChance() float64 {
+	rules := g.rules()
+	chance := rules.WallChance * float64(rules.wallRampFactor(g.Time))
+	return math.Min(1, chance*float64(g.Width*g.Height)/baseBoardArea)
+}
+
+// wallLimit 随机墙体的数量上限，墙体加速的模式中随游戏时间增加
+func (g *Game) wallLimit() int {
+	return g.MaxWalls * g.rules().wallRampFactor(g.Time)
+}
+
 // GenerateWall 生成新墙体
+// 墙体不会生成在蛇头2格范围内，也不会切断蛇头到食物的路径或让蛇没有足够的活动空间
 func (g *Game) GenerateWall() {
-	if len(g.Walls) >= g.MaxWalls {
+	if g.temporaryWalls() >= g.wallLimit() {
 		return
 	}
 
-	rand.Seed(time.Now().UnixNano())
-
 	// 找到所有可用的位置
 	usedPositions := make(map[Position]bool)
 
 	// 添加蛇的位置
-	for _, pos := range g.Snake.Body {
-		usedPositions[pos] = true
+	alive := g.aliveSnakes()
+	for _, snake := range alive {
+		for _, pos := range snake.Body {
+			usedPositions[pos] = true
+		}
 	}
 
 	// 添加食物的位置
@@ -158,40 +457,95 @@ func (g *Game) GenerateWall() {
 		usedPositions[wall.Position] = true
 	}
 
-	// 收集所有可用位置，同时确保墙体不会阻挡关键路径
+	// 收集所有可用位置，避免在任意蛇头周围形成包围圈
 	availablePositions := []Position{}
 	for x := 0; x < g.Width; x++ {
 		for y := 0; y < g.Height; y++ {
 			pos := Position{X: x, Y: y}
-			if !usedPositions[pos] {
-				// 确保墙体不会完全阻挡蛇的移动路径
-				// 1. 避免在蛇头周围形成包围圈
-				isNearHead := false
-				head := g.Snake.Body[0]
+			if usedPositions[pos] {
+				continue
+			}
+
+			isNearHead := false
+			for _, snake := range alive {
+				head := snake.Head()
 				// 检查是否在蛇头的2格范围内
 				if abs(pos.X-head.X) <= 2 && abs(pos.Y-head.Y) <= 2 {
 					isNearHead = true
-				}
-
-				// 2. 避免在边界形成无法通过的区域
-				// 允许大部分位置，但确保不会完全阻挡到食物的路径
-				if !isNearHead || rand.Float64() < 0.3 { // 有30%的概率即使在头部附近也允许生成
-					availablePositions = append(availablePositions, pos)
+					break
 				}
 			}
+			if !isNearHead {
+				availablePositions = append(availablePositions, pos)
+			}
 		}
 	}
 
-	if len(availablePositions) > 0 {
-		// 随机选择一个可用位置
-		randomIndex := rand.Intn(len(availablePositions))
+	// 随机抽取候选位置，检查放置后是否仍能到达食物并有足够的活动空间
+	board := newGrid(g)
+	before := g.wallReachability(board)
+	for attempt := 0; attempt < maxWallAttempts && len(availablePositions) > 0; attempt++ {
+		randomIndex := g.rng.Intn(len(availablePositions))
+		pos := availablePositions[randomIndex]
+		availablePositions[randomIndex] = availablePositions[len(availablePositions)-1]
+		availablePositions = availablePositions[:len(availablePositions)-1]
+
+		board.blocked[pos] = true
+		after := g.wallReachability(board)
+		board.blocked[pos] = false
+		if !after.keeps(before) {
+			continue
+		}
+
 		wall := Wall{
-			Position:  availablePositions[randomIndex],
-			CreatedAt: time.Now(),
-			Lifetime:  5 + rand.Intn(10), // 5-14秒的随机生命周期，符合墙体消失的需求
+			Position:  pos,
+			CreatedAt: g.clock.Now(),
+			Lifetime:  5 + g.rng.Intn(10), // 5-14秒的随机生命周期，符合墙体消失的需求
 		}
 		g.Walls = append(g.Walls, wall)
+		g.emit(Event{Type: EventWallSpawned, SnakeID: NoSnake, Position: &pos})
+		return
+	}
+}
+
+// reachability 每条存活的蛇能否到达食物、是否有足够的活动空间
+type reachability struct {
+	food []bool
+	room []bool
+}
+
+// wallReachability 检查每条存活的蛇从蛇头出发的连通情况
+// 泛洪覆盖整个棋盘，大棋盘上可到达的区域再大，墙体也可能把食物单独围住
+func (g *Game) wallReachability(board *grid) reachability {
+	var r reachability
+	for _, snake := range g.aliveSnakes() {
+		visited := board.flood(snake.Head(), g.Width*g.Height)
+		r.food = append(r.food, visited[g.Food.Position])
+		// 除蛇头外至少要能容纳整条蛇
+		r.room = append(r.room, len(visited)-1 >= len(snake.Body))
+	}
+	return r
+}
+
+// keeps 放置墙体后是否没有让任何蛇失去原本能到达的食物或活动空间
+func (r reachability) keeps(before reachability) bool {
+	for i := range before.food {
+		if (before.food[i] && !r.food[i]) || (before.room[i] && !r.room[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// temporaryWalls 随机生成的临时墙体数量，关卡的永久墙体不计入MaxWalls
+func (g *Game) temporaryWalls() int {
+	count := 0
+	for _, wall := range g.Walls {
+		if !wall.Permanent {
+			count++
+		}
 	}
+	return count
 }
 
 // abs 计算绝对值
@@ -203,121 +557,242 @@ func abs(x int) int {
 }
 
 // Update 更新游戏状态
+// 倒计时中只减少倒计时，游戏时钟不推进，倒计时结束后游戏继续运行
 func (g *Game) Update() {
+	if g.Status == GameStatusCountdown {
+		g.Countdown -= g.TickInterval
+		if g.Countdown <= 0 {
+			g.Countdown = 0
+			g.Status = GameStatusRunning
+		}
+		return
+	}
 	if g.Status != GameStatusRunning {
 		return
 	}
 
-	// 移动蛇
-	g.MoveSnake()
+	// 推进游戏时钟
+	interval := g.TickInterval
+	g.clock.Advance(time.Duration(interval) * time.Millisecond)
+	g.Tick++
+	now := g.clock.Now()
+
+	// 所有存活的蛇先应用一个排队的转向，再同时移动
+	alive := g.aliveSnakes()
+	for _, snake := range alive {
+		if len(snake.PendingTurns) > 0 {
+			snake.Direction = snake.PendingTurns[0]
+			snake.PendingTurns = snake.PendingTurns[1:]
+		}
+		g.MoveSnake(snake)
+	}
 
-	// 检查碰撞
-	if g.CheckCollision() {
-		g.Status = GameStatusEnded
+	// 检查碰撞，同一回合内撞车的蛇同时死亡
+	causes := g.CheckCollisions(alive)
+	for _, snake := range alive {
+		if cause, dead := causes[snake.ID]; dead {
+			g.kill(snake, cause)
+		}
+	}
+	if g.checkGameOver() {
 		return
 	}
 
-	// 检查是否吃到食物 - 根据返回值决定是否移除尾部
-	ateFood := g.CheckFoodCollision()
+	for _, snake := range alive {
+		if !snake.Alive {
+			continue
+		}
+
+		// 检查是否吃到食物 - 根据返回值决定是否移除尾部
+		ateFood := g.CheckFoodCollision(snake)
+
+		// 如果没有吃到食物，移除尾部（保持长度不变）
+		if !ateFood && len(snake.Body) > 0 {
+			snake.Body = snake.Body[:len(snake.Body)-1]
+		}
+	}
+
+	// 基于游戏时钟的时间差更新游戏时间
+	elapsedSeconds := int(now.Sub(g.LastUpdateTime) / time.Second)
+	// 如果经过了至少1秒，更新游戏时间（不足1秒的部分留到下次累计）
+	if elapsedSeconds >= 1 {
+		g.Time += elapsedSeconds
+		g.LastUpdateTime = g.LastUpdateTime.Add(time.Duration(elapsedSeconds) * time.Second)
+	}
 
-	// 如果没有吃到食物，移除尾部（保持长度不变）
-	if !ateFood && len(g.Snake.Body) > 0 {
-		g.Snake.Body = g.Snake.Body[:len(g.Snake.Body)-1]
+	// 检查是否长时间没有吃到食物（经典模式为10秒）
+	rules := g.rules()
+	if rules.Starvation > 0 {
+		for _, snake := range alive {
+			if snake.Alive && now.Sub(snake.LastFoodTime).Seconds() > float64(rules.Starvation) {
+				g.kill(snake, DeathStarvation)
+			}
+		}
+		if g.checkGameOver() {
+			return
+		}
 	}
 
-	// 基于实际时间差更新游戏时间
-	now := time.Now()
-	elapsedMilliseconds := now.Sub(g.LastUpdateTime).Milliseconds()
-	// 如果经过了至少1000毫秒，更新游戏时间
-	if elapsedMilliseconds >= 1000 {
-		g.Time += int(elapsedMilliseconds / 1000) // 转换为秒
-		g.LastUpdateTime = now
+	// 更新分数：时间(秒)*TimeScore + 豆子数量*FoodScore + 双倍得分的奖励，经典模式为时间 + 豆子*10
+	g.Score = 0
+	for _, snake := range g.Snakes {
+		if snake.Alive {
+			snake.Time = g.Time
+			snake.Score = snake.Time*rules.TimeScore + snake.FoodCount*rules.FoodScore + snake.Bonus
+		}
+		if snake.Score > g.Score {
+			g.Score = snake.Score
+		}
 	}
 
-	// 检查是否长时间没有吃到食物（10秒规则）
-	if time.Since(g.LastFoodTime).Seconds() > 10 {
-		g.Status = GameStatusEnded
+	// 限时模式到时结束
+	if rules.TimeLimit > 0 && g.Time >= rules.TimeLimit {
+		g.timeUp()
 		return
 	}
 
-	// 更新分数：时间(秒)*1 + 豆子数量*10
-	g.Score = g.Time + g.FoodCount*10
+	// 效果计时，到期后恢复速度
+	g.tickEffects(interval)
+	g.updateTickInterval()
 
 	// 更新最后更新时间
-	g.UpdatedAt = now // 使用之前定义的now变量
+	g.UpdatedAt = now
 
 	// 移除过期的墙体
-	now = time.Now() // 重用之前定义的now变量
 	var validWalls []Wall
 	for _, wall := range g.Walls {
-		if now.Sub(wall.CreatedAt).Seconds() < float64(wall.Lifetime) {
+		if wall.Permanent || now.Sub(wall.CreatedAt).Seconds() < float64(wall.Lifetime) {
 			validWalls = append(validWalls, wall)
+		} else {
+			pos := wall.Position
+			g.emit(Event{Type: EventWallExpired, SnakeID: NoSnake, Position: &pos})
 		}
 	}
 	g.Walls = validWalls
 
-	// 随机生成新墙体（每500ms约20%的概率，符合随时间生成的需求）
-	if rand.Float64() < 0.2 {
+	// 随机生成新墙体（15x15棋盘上每次更新约20%的概率，按棋盘面积缩放）
+	if g.rng.Float64() < g.wallChance() {
 		g.GenerateWall()
 	}
 }
 
-// MoveSnake 移动蛇 - 只有吃到豆子时才增加长度
-func (g *Game) MoveSnake() {
-	head := g.Snake.Body[0]
-	newHead := Position{X: head.X, Y: head.Y}
+// checkGameOver 检查游戏是否结束
+// 单人游戏在蛇死亡时结束，多人游戏在只剩一条或没有蛇存活时结束，剩下的蛇获胜
+func (g *Game) checkGameOver() bool {
+	alive := g.aliveSnakes()
+	if g.IsMultiplayer() {
+		if len(alive) > 1 {
+			return false
+		}
+		if len(alive) == 1 {
+			g.Winner = alive[0].ID
+		}
+	} else if len(alive) > 0 {
+		return false
+	}
 
-	switch g.Snake.Direction {
-	case Up:
-		newHead.Y--
-	case Down:
-		newHead.Y++
-	case Left:
-		newHead.X--
-	case Right:
-		newHead.X++
+	g.Status = GameStatusEnded
+	g.emit(Event{Type: EventGameEnded, SnakeID: g.Winner, Cause: g.DeathCause})
+	return true
+}
+
+// timeUp 游戏时间用完，结束游戏
+// 多人游戏中得分最高的存活蛇获胜，最高分相同时没有胜者
+func (g *Game) timeUp() {
+	if g.IsMultiplayer() {
+		best := -1
+		for _, snake := range g.aliveSnakes() {
+			switch {
+			case snake.Score > best:
+				best, g.Winner = snake.Score, snake.ID
+			case snake.Score == best:
+				g.Winner = NoWinner
+			}
+		}
 	}
 
+	// 存活的蛇保存成绩时以时间用完作为结束原因
+	for _, snake := range g.aliveSnakes() {
+		snake.DeathCause = EndTimeUp
+	}
+	g.Status = GameStatusEnded
+	g.DeathCause = EndTimeUp
+	g.emit(Event{Type: EventGameEnded, SnakeID: g.Winner, Cause: EndTimeUp})
+}
+
+// MoveSnake 移动蛇 - 只有吃到豆子时才增加长度
+func (g *Game) MoveSnake(snake *Snake) {
+	newHead := snake.Head().Move(snake.Direction)
+
 	// 将新头部添加到蛇身
-	g.Snake.Body = append([]Position{newHead}, g.Snake.Body...)
+	snake.Body = append([]Position{newHead}, snake.Body...)
 
 	// 默认情况下移除尾部，只有吃到豆子时才保留
 	// 注意：在Update方法中会根据是否吃到豆子来决定是否保留尾部
 }
 
-// CheckCollision 检查碰撞
-func (g *Game) CheckCollision() bool {
-	head := g.Snake.Body[0]
-
-	// 检查边界碰撞
-	if head.X < 0 || head.X >= g.Width || head.Y < 0 || head.Y >= g.Height {
-		return true
+// CheckCollisions 检查移动后的碰撞，返回本回合死亡的蛇ID及死亡原因
+// 撞到边界、墙体或任意蛇身（包括自己和尚未移除的尾部）的蛇死亡；
+// 两条蛇的头撞到同一格，或互相穿过对方头部时，双方都因迎头相撞死亡
+func (g *Game) CheckCollisions(alive []*Snake) map[int]string {
+	// 记录所有存活蛇的身体（不含本回合的新头部）属于哪条蛇
+	bodies := make(map[Position]*Snake)
+	for _, snake := range alive {
+		for _, pos := range snake.Body[1:] {
+			bodies[pos] = snake
+		}
 	}
 
-	// 检查自身碰撞
-	for i := 1; i < len(g.Snake.Body); i++ {
-		if head.X == g.Snake.Body[i].X && head.Y == g.Snake.Body[i].Y {
-			return true
-		}
+	// 统计每个格子上的蛇头数量
+	heads := make(map[Position]int)
+	for _, snake := range alive {
+		heads[snake.Head()]++
 	}
 
-	// 检查墙体碰撞
+	walls := make(map[Position]bool)
 	for _, wall := range g.Walls {
-		if head.X == wall.Position.X && head.Y == wall.Position.Y {
-			return true
-		}
+		walls[wall.Position] = true
 	}
 
-	return false
+	causes := make(map[int]string)
+	for _, snake := range alive {
+		head := snake.Head()
+		owner := bodies[head]
+		switch {
+		case head.X < 0 || head.X >= g.Width || head.Y < 0 || head.Y >= g.Height:
+			causes[snake.ID] = DeathBoundary
+		case walls[head] && !snake.HasEffect(FoodPhase):
+			causes[snake.ID] = DeathWall
+		case heads[head] > 1:
+			causes[snake.ID] = DeathHeadOn
+		case owner == snake:
+			causes[snake.ID] = DeathSelf
+		case owner != nil && head == owner.Body[1] && owner.Head() == snake.Body[1]:
+			// 两条蛇互相穿过对方的头部
+			causes[snake.ID] = DeathHeadOn
+		case owner != nil:
+			causes[snake.ID] = DeathSnake
+		}
+	}
+	return causes
 }
 
-// CheckFoodCollision 检查是否吃到食物
-func (g *Game) CheckFoodCollision() bool {
-	head := g.Snake.Body[0]
-	if head.X == g.Food.Position.X && head.Y == g.Food.Position.Y {
-		// 吃到食物，增加分数和长度
+// CheckFoodCollision 检查蛇是否吃到食物
+func (g *Game) CheckFoodCollision(snake *Snake) bool {
+	if snake.Head() == g.Food.Position {
+		// 吃到食物，增加分数和长度，双倍得分期间额外加分
+		snake.FoodCount++
+		if snake.HasEffect(FoodDouble) {
+			snake.Bonus += g.rules().FoodScore
+		}
+		snake.LastFoodTime = g.clock.Now()
 		g.FoodCount++
-		g.LastFoodTime = time.Now()
+		food := g.Food.Position
+		g.emit(Event{Type: EventFoodEaten, SnakeID: snake.ID, Position: &food})
+		g.applyFood(snake, g.Food)
+
+		// 按模式的速度曲线和效果调整更新间隔
+		g.updateTickInterval()
 
 		// 生成新食物
 		g.GenerateFood()
@@ -327,17 +802,42 @@ func (g *Game) CheckFoodCollision() bool {
 	return false
 }
 
-// ChangeDirection 改变蛇的移动方向
-func (g *Game) ChangeDirection(newDirection Direction) {
+// maxPendingTurns 每条蛇最多排队的转向数量
+const maxPendingTurns = 3
+
+// ChangeDirection 改变指定蛇的移动方向，返回方向是否被接受
+// 转向以排队的方式生效，两次更新之间连续按下的方向不会互相覆盖
+// 每个转向都与它生效时蛇实际的移动方向比较，因此快速连按也不会掉头
+func (g *Game) ChangeDirection(snakeID int, newDirection Direction) bool {
+	snake := g.Snake(snakeID)
+	if snake == nil || !snake.Alive {
+		return false
+	}
+
+	// 与排在最后的转向（没有时为当前方向）比较
+	heading := snake.Direction
+	if n := len(snake.PendingTurns); n > 0 {
+		heading = snake.PendingTurns[n-1]
+	}
+
 	// 防止180度转向
-	if (g.Snake.Direction == Up && newDirection == Down) ||
-		(g.Snake.Direction == Down && newDirection == Up) ||
-		(g.Snake.Direction == Left && newDirection == Right) ||
-		(g.Snake.Direction == Right && newDirection == Left) {
-		return
+	if newDirection == opposite(heading) {
+		return false
 	}
 
-	if g.Status == GameStatusRunning {
-		g.Snake.Direction = newDirection
+	if !g.Active() {
+		return false
 	}
+
+	// 与生效时的方向相同，不需要排队
+	if newDirection == heading {
+		return true
+	}
+	if len(snake.PendingTurns) >= maxPendingTurns {
+		return false
+	}
+
+	snake.PendingTurns = append(snake.PendingTurns, newDirection)
+	g.inputs = append(g.inputs, ReplayInput{Tick: g.Tick, SnakeID: snakeID, Direction: newDirection})
+	return true
 }
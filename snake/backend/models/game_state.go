@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"math/rand"
+	"time"
+)
+
+// countingSource 记录取用次数的随机数源
+// 恢复时用相同种子重新生成并跳过已取用的次数，即可得到完全相同的后续序列
+type countingSource struct {
+	src   rand.Source
+	calls int64
+}
+
+// newCountingSource 创建随机数源，并跳过前skip次取用
+func newCountingSource(seed, skip int64) *countingSource {
+	s := &countingSource{src: rand.NewSource(seed)}
+	for s.calls < skip {
+		s.Int63()
+	}
+	return s
+}
+
+// Int63 实现rand.Source
+func (s *countingSource) Int63() int64 {
+	s.calls++
+	return s.src.Int63()
+}
+
+// Seed 实现rand.Source
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.calls = 0
+}
+
+// setRandSource 设置游戏的随机数源
+func (g *Game) setRandSource(src *countingSource) {
+	g.src = src
+	g.rng = rand.New(src)
+}
+
+// gameState 游戏的完整持久化状态
+// 除了对外公开的字段，还包括随机数源进度、时钟和录像输入，恢复后可以继续精确运行
+type gameState struct {
+	*Game
+	RandCalls   int64         `json:"randCalls"`
+	ClockNow    *time.Time    `json:"clockNow,omitempty"` // 为空表示使用系统时间
+	Inputs      []ReplayInput `json:"inputs"`
+	TokenHashes []string      `json:"tokenHashes"` // 按蛇ID排列的控制令牌摘要
+}
+
+// MarshalState 序列化游戏的完整状态
+func (g *Game) MarshalState() ([]byte, error) {
+	state := gameState{
+		Game:      g,
+		RandCalls: g.src.calls,
+		Inputs:    g.inputs,
+	}
+	for _, snake := range g.Snakes {
+		state.TokenHashes = append(state.TokenHashes, snake.controlTokenHash)
+	}
+	if clock, ok := g.clock.(*TickClock); ok {
+		now := clock.Now()
+		state.ClockNow = &now
+	}
+	return json.Marshal(state)
+}
+
+// UnmarshalGameState 从MarshalState的结果恢复游戏
+func UnmarshalGameState(data []byte) (*Game, error) {
+	state := gameState{Game: &Game{}}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	game := state.Game
+	game.setRandSource(newCountingSource(game.Seed, state.RandCalls))
+	game.inputs = state.Inputs
+	for i, hash := range state.TokenHashes {
+		if i < len(game.Snakes) {
+			game.Snakes[i].controlTokenHash = hash
+		}
+	}
+	if state.ClockNow != nil {
+		game.clock = NewTickClock(*state.ClockNow)
+	} else {
+		game.clock = RealClock{}
+	}
+	return game, nil
+}
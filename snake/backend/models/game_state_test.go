@@ -0,0 +1,75 @@
+package models
+
+import "testing"
+
+func TestCountingSourceSkip(t *testing.T) {
+	tests := []struct {
+		name string
+		seed int64
+		skip int64
+	}{
+		{"不跳过", 1, 0},
+		{"跳过一次", 1, 1},
+		{"跳过多次", 99, 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := newCountingSource(tt.seed, 0)
+			for i := int64(0); i < tt.skip; i++ {
+				original.Int63()
+			}
+			restored := newCountingSource(tt.seed, tt.skip)
+			if restored.calls != tt.skip {
+				t.Fatalf("calls = %d, want %d", restored.calls, tt.skip)
+			}
+			for i := 0; i < 10; i++ {
+				if got, want := restored.Int63(), original.Int63(); got != want {
+					t.Fatalf("第%d次取用 = %d, want %d", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGameStateRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  GameOptions
+		ticks int64
+	}{
+		{"刚创建", GameOptions{Width: 15, Height: 15, MaxWalls: 5, Seed: 11, Mode: GameModeClassic, TickInterval: 100}, 0},
+		{"运行中", GameOptions{Width: 15, Height: 15, MaxWalls: 5, Seed: 11, Mode: GameModeClassic, TickInterval: 100}, 120},
+		{"随机墙体较多", GameOptions{Width: 12, Height: 12, MaxWalls: 12, Seed: 5, Mode: GameModeSurvival, TickInterval: 100}, 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := NewGame("state", tt.opts, NewTickClock(testStart))
+			playBot(game, tt.ticks, BotHard)
+
+			data, err := game.MarshalState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored, err := UnmarshalGameState(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored.src.calls != game.src.calls {
+				t.Fatalf("随机数取用次数 = %d, want %d", restored.src.calls, game.src.calls)
+			}
+			if got, want := mustJSON(t, restored), mustJSON(t, game); got != want {
+				t.Fatalf("恢复的状态与原游戏不同\n got: %s\nwant: %s", got, want)
+			}
+
+			// 恢复后继续运行，随机生成的食物和墙体必须与原游戏一致
+			playBot(game, tt.ticks+150, BotHard)
+			playBot(restored, tt.ticks+150, BotHard)
+			if got, want := mustJSON(t, restored), mustJSON(t, game); got != want {
+				t.Errorf("恢复后继续运行的状态与原游戏不同\n got: %s\nwant: %s", got, want)
+			}
+			if got, want := restored.Replay(), game.Replay(); len(got.Inputs) != len(want.Inputs) {
+				t.Errorf("录像输入数 = %d, want %d", len(got.Inputs), len(want.Inputs))
+			}
+		})
+	}
+}
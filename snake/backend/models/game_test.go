@@ -0,0 +1,335 @@
+package models
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testStart 测试中游戏时钟的起始时间
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// foodSequence 连续生成n次食物，返回食物的位置
+func foodSequence(g *Game, n int) []Position {
+	positions := make([]Position, 0, n)
+	for i := 0; i < n; i++ {
+		g.GenerateFood()
+		positions = append(positions, g.Food.Position)
+	}
+	return positions
+}
+
+func TestNewGameSeed(t *testing.T) {
+	tests := []struct {
+		name      string
+		seed      int64
+		otherSeed int64
+		wantSame  bool
+	}{
+		{"相同种子", 42, 42, true},
+		{"不同种子", 42, 43, false},
+		{"种子为0", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := GameOptions{Width: 15, Height: 15, MaxWalls: 5, Mode: GameModeClassic, TickInterval: 100}
+			opts.Seed = tt.seed
+			game := NewGame("a", opts, NewTickClock(testStart))
+			opts.Seed = tt.otherSeed
+			other := NewGame("b", opts, NewTickClock(testStart))
+
+			if game.Seed != tt.seed {
+				t.Errorf("Seed = %d, want %d", game.Seed, tt.seed)
+			}
+			got, want := foodSequence(game, 20), foodSequence(other, 20)
+			if same := reflect.DeepEqual(got, want); same != tt.wantSame {
+				t.Errorf("食物位置相同 = %v, want %v\n%v\n%v", same, tt.wantSame, got, want)
+			}
+		})
+	}
+}
+
+func TestIsValidSeed(t *testing.T) {
+	tests := []struct {
+		seed int64
+		want bool
+	}{
+		{0, true},
+		{42, true},
+		{1<<53 - 1, true},
+		{1 << 53, false},
+		{-1, false},
+		{math.MaxInt64, false},
+	}
+	for _, tt := range tests {
+		if got := IsValidSeed(tt.seed); got != tt.want {
+			t.Errorf("IsValidSeed(%d) = %v, want %v", tt.seed, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateHeadOn(t *testing.T) {
+	tests := []struct {
+		name       string
+		spawns     []Spawn
+		wantWinner int
+	}{
+		{
+			name:       "撞到同一格",
+			spawns:     []Spawn{{Position{X: 2, Y: 3}, Right}, {Position{X: 4, Y: 3}, Left}},
+			wantWinner: NoWinner,
+		},
+		{
+			name:       "互相穿过",
+			spawns:     []Spawn{{Position{X: 3, Y: 3}, Right}, {Position{X: 4, Y: 3}, Left}},
+			wantWinner: NoWinner,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := NewGame("head-on", GameOptions{Width: 9, Height: 7, Seed: 1, Mode: GameModeZen, TickInterval: 100, Players: 2}, NewTickClock(testStart))
+			game.spawnSnakes(tt.spawns)
+			game.Food = Food{Position: Position{X: 0, Y: 0}, Type: FoodNormal}
+			game.Start()
+			game.Update()
+
+			if game.Status != GameStatusEnded {
+				t.Fatalf("Status = %s, want %s", game.Status, GameStatusEnded)
+			}
+			if game.Winner != tt.wantWinner {
+				t.Errorf("Winner = %d, want %d", game.Winner, tt.wantWinner)
+			}
+			for _, snake := range game.Snakes {
+				if snake.Alive || snake.DeathCause != DeathHeadOn {
+					t.Errorf("蛇%d Alive = %v, DeathCause = %q, want 因%s死亡", snake.ID, snake.Alive, snake.DeathCause, DeathHeadOn)
+				}
+			}
+		})
+	}
+}
+
+// body 按从头到尾的顺序构造蛇身
+func body(coords ...int) []Position {
+	positions := make([]Position, 0, len(coords)/2)
+	for i := 0; i+1 < len(coords); i += 2 {
+		positions = append(positions, Position{X: coords[i], Y: coords[i+1]})
+	}
+	return positions
+}
+
+func TestCheckCollisions(t *testing.T) {
+	// 每条蛇的身体为移动后、移除尾部前的状态，第一个格子是新的蛇头
+	tests := []struct {
+		name   string
+		bodies [][]Position
+		walls  []Position
+		want   map[int]string
+	}{
+		{
+			name:   "没有碰撞",
+			bodies: [][]Position{body(2, 2, 1, 2, 0, 2)},
+			want:   map[int]string{},
+		},
+		{
+			name:   "撞到边界",
+			bodies: [][]Position{body(5, 2, 4, 2, 3, 2)},
+			want:   map[int]string{0: DeathBoundary},
+		},
+		{
+			name:   "撞到墙体",
+			bodies: [][]Position{body(2, 2, 1, 2, 0, 2)},
+			walls:  []Position{{X: 2, Y: 2}},
+			want:   map[int]string{0: DeathWall},
+		},
+		{
+			name:   "撞到自己",
+			bodies: [][]Position{body(1, 1, 1, 2, 2, 2, 2, 1, 1, 1, 0, 1)},
+			want:   map[int]string{0: DeathSelf},
+		},
+		{
+			name:   "撞到其他蛇的身体",
+			bodies: [][]Position{body(2, 2, 2, 3, 2, 4), body(3, 1, 2, 1, 2, 2, 1, 2)},
+			want:   map[int]string{0: DeathSnake},
+		},
+		{
+			name:   "两个蛇头撞到同一格",
+			bodies: [][]Position{body(2, 2, 1, 2, 0, 2), body(2, 2, 3, 2, 4, 2)},
+			want:   map[int]string{0: DeathHeadOn, 1: DeathHeadOn},
+		},
+		{
+			name:   "互相穿过对方的头部",
+			bodies: [][]Position{body(2, 2, 1, 2, 0, 2), body(1, 2, 2, 2, 3, 2)},
+			want:   map[int]string{0: DeathHeadOn, 1: DeathHeadOn},
+		},
+		{
+			name:   "撞到对方即将移走的尾部",
+			bodies: [][]Position{body(2, 0, 1, 0, 0, 0), body(3, 1, 3, 0, 2, 0)},
+			want:   map[int]string{0: DeathSnake},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := &Game{Width: 5, Height: 5}
+			for _, pos := range tt.walls {
+				game.Walls = append(game.Walls, Wall{Position: pos, Permanent: true})
+			}
+			for i, b := range tt.bodies {
+				game.Snakes = append(game.Snakes, &Snake{ID: i, Body: b, Alive: true})
+			}
+			if got := game.CheckCollisions(game.Snakes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckCollisions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWallReachabilityLargeBoard(t *testing.T) {
+	opts := GameOptions{Width: 40, Height: 40, Seed: 1, Mode: GameModeClassic, TickInterval: 100}
+	g := NewGame("a", opts, NewTickClock(testStart))
+	g.Snakes[0].Body = body(5, 5, 4, 5, 3, 5)
+	g.Food.Position = Position{X: 30, Y: 30}
+
+	// 食物周围一圈墙体，只在(30, 28)留一个缺口；蛇所在的区域远大于棋盘的一小部分
+	gap := Position{X: 30, Y: 28}
+	for x := 28; x <= 32; x++ {
+		for y := 28; y <= 32; y++ {
+			pos := Position{X: x, Y: y}
+			if (x == 28 || x == 32 || y == 28 || y == 32) && pos != gap {
+				g.Walls = append(g.Walls, Wall{Position: pos, Permanent: true})
+			}
+		}
+	}
+
+	board := newGrid(g)
+	before := g.wallReachability(board)
+	if !before.food[0] || !before.room[0] {
+		t.Fatalf("封住缺口前 = %+v, want 能到达食物且空间充足", before)
+	}
+
+	tests := []struct {
+		name  string
+		wall  Position
+		keeps bool
+	}{
+		{"封住缺口", gap, false},
+		{"缺口外侧", Position{X: 30, Y: 27}, false},
+		{"远离食物", Position{X: 15, Y: 15}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board.blocked[tt.wall] = true
+			defer delete(board.blocked, tt.wall)
+			if got := g.wallReachability(board).keeps(before); got != tt.keeps {
+				t.Errorf("keeps = %v, want %v", got, tt.keeps)
+			}
+		})
+	}
+}
+
+func TestTimeUpDeathCause(t *testing.T) {
+	opts := GameOptions{Width: 15, Height: 15, Seed: 1, Mode: GameModeTimeAttack, TickInterval: 100, Players: 2}
+	g := NewGame("a", opts, NewTickClock(testStart))
+	g.Snakes[1].Alive = false
+	g.Snakes[1].DeathCause = DeathWall
+
+	g.timeUp()
+	if g.Status != GameStatusEnded || g.DeathCause != EndTimeUp {
+		t.Fatalf("Status = %q, DeathCause = %q", g.Status, g.DeathCause)
+	}
+	if got := g.Snakes[0].DeathCause; got != EndTimeUp {
+		t.Errorf("存活的蛇 DeathCause = %q, want %q", got, EndTimeUp)
+	}
+	if got := g.Snakes[1].DeathCause; got != DeathWall {
+		t.Errorf("已死亡的蛇 DeathCause = %q, want %q", got, DeathWall)
+	}
+}
+
+func TestChangeDirectionQueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		inputs      []Direction
+		wantOK      []bool
+		wantPending []Direction
+		wantDirs    []Direction // 之后每次更新后蛇的移动方向
+	}{
+		{
+			name:        "每次更新生效一个转向",
+			inputs:      []Direction{Up, Left},
+			wantOK:      []bool{true, true},
+			wantPending: []Direction{Up, Left},
+			wantDirs:    []Direction{Up, Left, Left},
+		},
+		{
+			name:        "与当前方向相反",
+			inputs:      []Direction{Left},
+			wantOK:      []bool{false},
+			wantPending: nil,
+			wantDirs:    []Direction{Right},
+		},
+		{
+			name:        "掉头按最后排队的方向判断",
+			inputs:      []Direction{Up, Down, Left},
+			wantOK:      []bool{true, false, true},
+			wantPending: []Direction{Up, Left},
+			wantDirs:    []Direction{Up, Left},
+		},
+		{
+			name:        "与当前方向相同时不排队",
+			inputs:      []Direction{Right},
+			wantOK:      []bool{true},
+			wantPending: nil,
+			wantDirs:    []Direction{Right},
+		},
+		{
+			name:        "重复的转向只排一次",
+			inputs:      []Direction{Up, Up, Up},
+			wantOK:      []bool{true, true, true},
+			wantPending: []Direction{Up},
+			wantDirs:    []Direction{Up, Up},
+		},
+		{
+			name:        "最多排队3个转向",
+			inputs:      []Direction{Up, Left, Down, Right},
+			wantOK:      []bool{true, true, true, false},
+			wantPending: []Direction{Up, Left, Down},
+			wantDirs:    []Direction{Up, Left, Down, Down},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGame("a", GameOptions{Width: 15, Height: 15, Seed: 1, Mode: GameModeZen, TickInterval: 100}, NewTickClock(testStart))
+			g.spawnSnakes([]Spawn{{Position{X: 7, Y: 7}, Right}})
+			g.Food = Food{Position: Position{X: 0, Y: 0}, Type: FoodNormal}
+			g.Start()
+			snake := g.Snakes[0]
+
+			var ok []bool
+			for _, d := range tt.inputs {
+				ok = append(ok, g.ChangeDirection(snake.ID, d))
+			}
+			if !reflect.DeepEqual(ok, tt.wantOK) {
+				t.Errorf("ChangeDirection() = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(snake.PendingTurns, tt.wantPending) {
+				t.Errorf("PendingTurns = %v, want %v", snake.PendingTurns, tt.wantPending)
+			}
+			// 录像只记录排队的转向
+			if len(g.inputs) != len(tt.wantPending) {
+				t.Errorf("录像输入 %d 个, want %d", len(g.inputs), len(tt.wantPending))
+			}
+
+			var dirs []Direction
+			for range tt.wantDirs {
+				g.Update()
+				dirs = append(dirs, snake.Direction)
+			}
+			if !reflect.DeepEqual(dirs, tt.wantDirs) {
+				t.Errorf("每次更新后的方向 = %v, want %v", dirs, tt.wantDirs)
+			}
+			if !snake.Alive {
+				t.Errorf("蛇意外死亡: %s", snake.DeathCause)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+// grid 棋盘占用情况，用于寻路和连通性检查
+type grid struct {
+	game    *Game
+	blocked map[Position]bool
+}
+
+// newGrid 标记墙体和所有存活蛇的身体为障碍
+// 碰撞检测在移除蛇尾之前进行，因此蛇尾同样是障碍
+func newGrid(g *Game) *grid {
+	b := &grid{game: g, blocked: make(map[Position]bool)}
+	for _, wall := range g.Walls {
+		b.blocked[wall.Position] = true
+	}
+	for _, snake := range g.aliveSnakes() {
+		for _, pos := range snake.Body {
+			b.blocked[pos] = true
+		}
+	}
+	return b
+}
+
+// free 判断位置是否在棋盘内且没有障碍
+func (b *grid) free(pos Position) bool {
+	return pos.X >= 0 && pos.X < b.game.Width && pos.Y >= 0 && pos.Y < b.game.Height && !b.blocked[pos]
+}
+
+// flood 从起点出发经过空格可以到达的所有格子（包括起点本身），最多统计limit个
+func (b *grid) flood(start Position, limit int) map[Position]bool {
+	visited := map[Position]bool{start: true}
+	queue := []Position{start}
+	for len(queue) > 0 && len(visited) < limit {
+		pos := queue[0]
+		queue = queue[1:]
+		for _, d := range directions {
+			next := pos.Move(d)
+			if b.free(next) && !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return visited
+}
+
+// area 从起点出发可以到达的格子数量，最多统计limit个
+func (b *grid) area(start Position, limit int) int {
+	return len(b.flood(start, limit))
+}
+
+// pathTo 用广度优先搜索寻找从蛇头出发到目标的最短路径，返回第一步的方向
+// 第一步只能走first中的方向，maxDepth为0时不限制步数
+func (b *grid) pathTo(head, target Position, first []Direction, maxDepth int) (Direction, bool) {
+	type node struct {
+		pos   Position
+		first Direction
+		depth int
+	}
+
+	visited := map[Position]bool{head: true}
+	var queue []node
+	for _, d := range first {
+		next := head.Move(d)
+		visited[next] = true
+		queue = append(queue, node{pos: next, first: d, depth: 1})
+	}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.pos == target {
+			return n.first, true
+		}
+		if maxDepth > 0 && n.depth >= maxDepth {
+			continue
+		}
+		for _, d := range directions {
+			next := n.pos.Move(d)
+			if b.free(next) && !visited[next] {
+				visited[next] = true
+				queue = append(queue, node{pos: next, first: n.first, depth: n.depth + 1})
+			}
+		}
+	}
+	return 0, false
+}
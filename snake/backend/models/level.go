@@ -0,0 +1,384 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 关卡地图符号
+const (
+	levelEmpty    = '.' // 空地
+	levelWall     = '#' // 永久墙体
+	levelFoodZone = '*' // 食物生成区域
+	levelComment  = ';' // 以此开头的行为注释
+)
+
+// levelSpawnDirections 出生点符号及蛇头朝向
+var levelSpawnDirections = map[rune]Direction{
+	'^': Up,
+	'v': Down,
+	'<': Left,
+	'>': Right,
+}
+
+// spawnLength 出生时蛇的长度
+const spawnLength = 3
+
+// Spawn 出生点，蛇头位于Position，身体沿朝向的反方向展开
+type Spawn struct {
+	Position  Position  `json:"position"`
+	Direction Direction `json:"direction"`
+}
+
+// Level 关卡地图
+type Level struct {
+	Name     string     `json:"name"`
+	Width    int        `json:"width"`
+	Height   int        `json:"height"`
+	Walls    []Position `json:"walls"`              // 永久墙体
+	Spawns   []Spawn    `json:"spawns"`             // 出生点，按顺序分配给各条蛇
+	FoodZone []Position `json:"foodZone"`           // 食物生成区域，为空时食物可以生成在任意空地
+	Map      string     `json:"map"`                // ASCII格式的原始地图
+	Version  int        `json:"version"`            // 版本号，每次修改后递增
+	Custom   bool       `json:"custom"`             // 是否为通过编辑器创建的关卡，否则来自levels目录
+	PlayerID int64      `json:"playerId,omitempty"` // 编辑器关卡的创建者，只有创建者可以修改或删除
+}
+
+// LevelError 关卡无法解析或未通过校验，包含发现的所有问题
+type LevelError struct {
+	Problems []string
+}
+
+func (e *LevelError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// ParseLevel 解析ASCII格式的关卡地图并校验关卡是否可玩，失败时返回*LevelError
+// 没有指定食物生成区域时，区域被限制为能从出生点到达的空地
+func ParseLevel(name string, data []byte) (*Level, error) {
+	level, err := ReadLevel(name, data)
+	if err != nil {
+		return nil, err
+	}
+	if problems := level.Check(); len(problems) > 0 {
+		return nil, &LevelError{Problems: problems}
+	}
+	level.LimitFoodZone()
+	return level, nil
+}
+
+// ReadLevel 解析ASCII格式的关卡地图，不校验关卡是否可玩
+// 每行一排格子：'.'空地、'#'永久墙体、'*'食物生成区域、'^' 'v' '<' '>'出生点及蛇头朝向；
+// 以';'开头的行和空行被忽略。存在无效的符号或行宽不一致时返回*LevelError
+func ReadLevel(name string, data []byte) (*Level, error) {
+	level := &Level{Name: name, Map: string(data)}
+	var problems []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	y := 0
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || line[0] == levelComment {
+			continue
+		}
+
+		row := []rune(line)
+		if level.Width == 0 {
+			level.Width = len(row)
+		} else if len(row) != level.Width {
+			problems = append(problems, fmt.Sprintf("第%d行宽度为%d，与第一行的%d不一致", y+1, len(row), level.Width))
+		}
+
+		for x, symbol := range row {
+			pos := Position{X: x, Y: y}
+			switch symbol {
+			case levelEmpty:
+			case levelWall:
+				level.Walls = append(level.Walls, pos)
+			case levelFoodZone:
+				level.FoodZone = append(level.FoodZone, pos)
+			default:
+				direction, ok := levelSpawnDirections[symbol]
+				if !ok {
+					problems = append(problems, fmt.Sprintf("第%d行第%d列是无效的符号%q", y+1, x+1, symbol))
+					continue
+				}
+				level.Spawns = append(level.Spawns, Spawn{Position: pos, Direction: direction})
+			}
+		}
+		y++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	level.Height = y
+
+	if len(problems) > 0 {
+		return nil, &LevelError{Problems: problems}
+	}
+	return level, nil
+}
+
+// Body 返回出生点处蛇的初始身体
+func (s Spawn) Body() []Position {
+	body := make([]Position, spawnLength)
+	pos := s.Position
+	for i := range body {
+		body[i] = pos
+		pos = pos.Move(opposite(s.Direction))
+	}
+	return body
+}
+
+// inBounds 判断位置是否在关卡内
+func (l *Level) inBounds(pos Position) bool {
+	return pos.X >= 0 && pos.X < l.Width && pos.Y >= 0 && pos.Y < l.Height
+}
+
+// Check 校验关卡是否可玩，返回发现的所有问题
+// 尺寸必须在允许范围内，至少有一个出生点，出生时的蛇身不能越界或与墙体、其他蛇重叠，
+// 蛇头前方不能紧贴边界、墙体或蛇身，每个出生点都必须能到达食物生成区域，
+// 并且食物生成区域的每个格子都必须能从某个出生点到达
+func (l *Level) Check() []string {
+	if l.Width < MinBoardSize || l.Width > MaxBoardSize || l.Height < MinBoardSize || l.Height > MaxBoardSize {
+		// 尺寸无效时不再检查其余内容
+		return []string{fmt.Sprintf("关卡尺寸%dx%d超出允许范围%d-%d", l.Width, l.Height, MinBoardSize, MaxBoardSize)}
+	}
+
+	var problems []string
+	if len(l.Spawns) == 0 {
+		problems = append(problems, "关卡没有出生点")
+	}
+	if len(l.Spawns) > MaxPlayers {
+		problems = append(problems, fmt.Sprintf("关卡最多只能有%d个出生点", MaxPlayers))
+	}
+
+	walls := l.wallSet()
+	blocked := make(map[Position]bool)
+	for pos := range walls {
+		blocked[pos] = true
+	}
+
+	// 出生时的蛇身
+	for i, spawn := range l.Spawns {
+		for _, pos := range spawn.Body() {
+			if !l.inBounds(pos) || blocked[pos] {
+				problems = append(problems, fmt.Sprintf("第%d个出生点(%d,%d)的蛇身越界或与墙体、其他蛇重叠", i+1, spawn.Position.X, spawn.Position.Y))
+				break
+			}
+			blocked[pos] = true
+		}
+	}
+
+	// 出生后的第一步不能直接撞上边界、墙体或任何蛇的初始身体
+	for i, spawn := range l.Spawns {
+		if front := spawn.Position.Move(spawn.Direction); !l.inBounds(front) || blocked[front] {
+			problems = append(problems, fmt.Sprintf("第%d个出生点(%d,%d)正对边界、墙体或蛇身", i+1, spawn.Position.X, spawn.Position.Y))
+		}
+	}
+
+	// 蛇身会移开，可达性只受墙体限制
+	reachable := make(map[Position]bool)
+	for i, spawn := range l.Spawns {
+		visited := l.reachable(spawn.Position, walls)
+		if !l.reachesZone(visited) {
+			problems = append(problems, fmt.Sprintf("第%d个出生点(%d,%d)无法到达食物生成区域", i+1, spawn.Position.X, spawn.Position.Y))
+		}
+		for pos := range visited {
+			reachable[pos] = true
+		}
+	}
+
+	// 食物不能生成在任何蛇都到达不了的格子
+	if len(l.Spawns) > 0 {
+		for _, pos := range l.FoodZone {
+			if !reachable[pos] {
+				problems = append(problems, fmt.Sprintf("食物生成区域(%d,%d)无法从任何出生点到达", pos.X, pos.Y))
+			}
+		}
+	}
+	return problems
+}
+
+// wallSet 返回永久墙体的位置集合
+func (l *Level) wallSet() map[Position]bool {
+	walls := make(map[Position]bool)
+	for _, pos := range l.Walls {
+		walls[pos] = true
+	}
+	return walls
+}
+
+// reachesZone 可到达的格子中是否有可以生成食物的格子
+// 没有食物生成区域时任意空地都可以生成食物
+func (l *Level) reachesZone(visited map[Position]bool) bool {
+	if len(l.FoodZone) == 0 {
+		return len(visited) > 1
+	}
+	for _, pos := range l.FoodZone {
+		if visited[pos] {
+			return true
+		}
+	}
+	return false
+}
+
+// reachable 从起点出发不穿过墙体能到达的所有格子，包括起点
+func (l *Level) reachable(start Position, walls map[Position]bool) map[Position]bool {
+	visited := map[Position]bool{start: true}
+	queue := []Position{start}
+	for len(queue) > 0 {
+		pos := queue[0]
+		queue = queue[1:]
+		for _, d := range directions {
+			next := pos.Move(d)
+			if !l.inBounds(next) || walls[next] || visited[next] {
+				continue
+			}
+			visited[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return visited
+}
+
+// LimitFoodZone 没有指定食物生成区域时，把区域限制为能从出生点到达的空地，避免食物生成在封闭的空间里
+// 所有空地都能到达时保持为空，表示任意空地；关卡必须已通过Check校验
+func (l *Level) LimitFoodZone() {
+	if len(l.FoodZone) > 0 {
+		return
+	}
+	walls := l.wallSet()
+	reachable := make(map[Position]bool)
+	for _, spawn := range l.Spawns {
+		for pos := range l.reachable(spawn.Position, walls) {
+			reachable[pos] = true
+		}
+	}
+	if len(reachable)+len(walls) == l.Width*l.Height {
+		return
+	}
+
+	// 按固定顺序收集，保证相同关卡的食物生成顺序一致
+	for x := 0; x < l.Width; x++ {
+		for y := 0; y < l.Height; y++ {
+			if pos := (Position{X: x, Y: y}); reachable[pos] {
+				l.FoodZone = append(l.FoodZone, pos)
+			}
+		}
+	}
+}
+
+// 已加载的关卡
+// levels为每个关卡当前可用的版本，levelVersions保留所有版本以便回放旧版本关卡上的游戏
+var (
+	levels        = make(map[string]*Level)
+	levelVersions = make(map[string]map[int]*Level)
+	levelsMutex   sync.RWMutex
+)
+
+// LoadLevels 加载目录中所有.txt关卡文件，关卡名为去掉扩展名的文件名，版本为1
+// 返回成功加载的关卡数量，以及每个无效关卡的错误
+func LoadLevels(dir string) (int, []error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return 0, []error{err}
+	}
+
+	loaded := 0
+	var errs []error
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("关卡%s: %v", name, err))
+			continue
+		}
+		level, err := ParseLevel(name, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("关卡%s: %v", name, err))
+			continue
+		}
+		level.Version = 1
+		RegisterLevel(level)
+		loaded++
+	}
+	return loaded, errs
+}
+
+// RegisterLevel 注册关卡的一个版本，版本不低于当前版本时成为当前版本
+func RegisterLevel(level *Level) {
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+
+	if levelVersions[level.Name] == nil {
+		levelVersions[level.Name] = make(map[int]*Level)
+	}
+	levelVersions[level.Name][level.Version] = level
+	if current, ok := levels[level.Name]; !ok || level.Version >= current.Version {
+		levels[level.Name] = level
+	}
+}
+
+// UnregisterLevel 下架关卡，之后不能再用它创建游戏，但已有版本仍可用于回放
+func UnregisterLevel(name string) {
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+
+	delete(levels, name)
+}
+
+// GetLevel 按名称获取关卡的当前版本
+func GetLevel(name string) (*Level, bool) {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	level, ok := levels[name]
+	return level, ok
+}
+
+// GetLevelVersion 按名称和版本获取关卡，version为0时返回当前版本
+func GetLevelVersion(name string, version int) (*Level, bool) {
+	if version == 0 {
+		return GetLevel(name)
+	}
+
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	level, ok := levelVersions[name][version]
+	return level, ok
+}
+
+// LatestLevelVersion 返回关卡已注册的最高版本，包括已下架的关卡，没有时返回0
+func LatestLevelVersion(name string) int {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	latest := 0
+	for version := range levelVersions[name] {
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
+
+// ListLevels 按名称顺序列出所有关卡的当前版本
+func ListLevels() []*Level {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	list := make([]*Level, 0, len(levels))
+	for _, level := range levels {
+		list = append(list, level)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
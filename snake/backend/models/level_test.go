@@ -0,0 +1,197 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// levelMap 用行拼接出关卡地图
+func levelMap(rows ...string) string {
+	return strings.Join(rows, "\n") + "\n"
+}
+
+func TestReadLevel(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantWidth  int
+		wantHeight int
+		wantWalls  int
+		wantSpawns []Spawn
+		wantZone   int
+		wantErr    bool
+	}{
+		{
+			name:       "忽略注释和空行",
+			data:       levelMap("; 注释", "", "#####", "#.>.#", "#.*.#", "#####", ""),
+			wantWidth:  5,
+			wantHeight: 4,
+			wantWalls:  14,
+			wantSpawns: []Spawn{{Position{X: 2, Y: 1}, Right}},
+			wantZone:   1,
+		},
+		{
+			name:       "出生点按出现顺序排列",
+			data:       levelMap("v....", ".....", "....^"),
+			wantWidth:  5,
+			wantHeight: 3,
+			wantSpawns: []Spawn{{Position{X: 0, Y: 0}, Down}, {Position{X: 4, Y: 2}, Up}},
+		},
+		{
+			name:    "无效的符号",
+			data:    levelMap(".....", "..x..", "....."),
+			wantErr: true,
+		},
+		{
+			name:    "行宽不一致",
+			data:    levelMap(".....", "....", "....."),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := ReadLevel(tt.name, []byte(tt.data))
+			if tt.wantErr {
+				if _, ok := err.(*LevelError); !ok {
+					t.Fatalf("err = %v, want *LevelError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if level.Width != tt.wantWidth || level.Height != tt.wantHeight {
+				t.Errorf("尺寸 = %dx%d, want %dx%d", level.Width, level.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if len(level.Walls) != tt.wantWalls {
+				t.Errorf("墙体数 = %d, want %d", len(level.Walls), tt.wantWalls)
+			}
+			if !reflect.DeepEqual(level.Spawns, tt.wantSpawns) {
+				t.Errorf("Spawns = %v, want %v", level.Spawns, tt.wantSpawns)
+			}
+			if len(level.FoodZone) != tt.wantZone {
+				t.Errorf("食物生成区域 = %d格, want %d格", len(level.FoodZone), tt.wantZone)
+			}
+		})
+	}
+}
+
+func TestLevelCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string // 每个问题中应包含的内容，为空表示关卡可玩
+	}{
+		{
+			name: "可玩的关卡",
+			data: levelMap("#######", "#.....#", "#..>..#", "#.***.#", "#######"),
+		},
+		{
+			name: "尺寸过小",
+			data: levelMap("..>.", "....", "...."),
+			want: []string{"超出允许范围"},
+		},
+		{
+			name: "没有出生点",
+			data: levelMap(".....", ".....", ".....", ".....", "....."),
+			want: []string{"没有出生点"},
+		},
+		{
+			name: "蛇身越界",
+			data: levelMap(".>...", ".....", ".....", ".....", "....."),
+			want: []string{"蛇身越界"},
+		},
+		{
+			name: "蛇身与墙体重叠",
+			data: levelMap("#.>..", ".....", ".....", ".....", "....."),
+			want: []string{"蛇身越界或与墙体"},
+		},
+		{
+			name: "正对墙体",
+			data: levelMap("..>#.", ".....", ".....", ".....", "....."),
+			want: []string{"正对边界、墙体或蛇身"},
+		},
+		{
+			name: "正对边界",
+			data: levelMap("....>", ".....", ".....", ".....", "....."),
+			want: []string{"正对边界、墙体或蛇身"},
+		},
+		{
+			name: "正对另一条蛇的身体",
+			data: levelMap(".......", ".......", "...><..", ".......", "......."),
+			want: []string{"第1个出生点(3,2)正对", "第2个出生点(4,2)正对"},
+		},
+		{
+			name: "出生点到达不了食物生成区域",
+			data: levelMap("..>..", "#####", "..*..", ".....", "....."),
+			want: []string{"第1个出生点(2,0)无法到达食物生成区域", "食物生成区域(2,2)无法从任何出生点到达"},
+		},
+		{
+			name: "部分食物生成区域无法到达",
+			data: levelMap("*#...", "##...", "..>*.", ".....", "....."),
+			want: []string{"食物生成区域(0,0)无法从任何出生点到达"},
+		},
+		{
+			name: "食物生成区域分别能从不同的出生点到达",
+			data: levelMap("..>*.", "#####", "..>*.", ".....", "....."),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := ReadLevel(tt.name, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			problems := level.Check()
+			if len(problems) != len(tt.want) {
+				t.Fatalf("Check() = %q, want %d个问题", problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("第%d个问题 = %q, want 包含%q", i+1, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitFoodZone(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Position
+	}{
+		{
+			name: "所有空地都能到达时不限制",
+			data: levelMap(".....", "..>..", "....."),
+		},
+		{
+			name: "指定了食物生成区域时不变",
+			data: levelMap("*#...", "##...", "..>*."),
+			want: []Position{{X: 0, Y: 0}, {X: 3, Y: 2}},
+		},
+		{
+			name: "排除封闭的空地",
+			data: levelMap(".#...", "##...", "..>.."),
+			want: []Position{
+				{X: 0, Y: 2}, {X: 1, Y: 2},
+				{X: 2, Y: 0}, {X: 2, Y: 1}, {X: 2, Y: 2},
+				{X: 3, Y: 0}, {X: 3, Y: 1}, {X: 3, Y: 2},
+				{X: 4, Y: 0}, {X: 4, Y: 1}, {X: 4, Y: 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := ReadLevel(tt.name, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			level.LimitFoodZone()
+			if !reflect.DeepEqual(level.FoodZone, tt.want) {
+				t.Errorf("FoodZone = %v, want %v", level.FoodZone, tt.want)
+			}
+		})
+	}
+}
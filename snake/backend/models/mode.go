@@ -0,0 +1,116 @@
+package models
+
+import "sort"
+
+// 游戏模式
+const (
+	GameModeClassic    = "classic"     // 经典模式：吃到豆子后逐渐加速
+	GameModeSteady     = "steady"      // 匀速模式：速度始终不变
+	GameModeTimeAttack = "time_attack" // 限时模式：60秒内吃到尽量多的豆子
+	GameModeZen        = "zen"         // 禅模式：不会饿死，也没有随机墙体
+	GameModeSurvival   = "survival"    // 生存模式：随机墙体随时间越来越多
+)
+
+// SpeedCurve 速度曲线，根据吃到的豆子数量计算更新间隔
+type SpeedCurve struct {
+	StepPerFood int `json:"stepPerFood"` // 每吃一个豆子减少的间隔（毫秒）
+	MinInterval int `json:"minInterval"` // 间隔下限（毫秒）
+}
+
+// Interval 计算吃到foodCount个豆子后的更新间隔（毫秒）
+func (c SpeedCurve) Interval(base, foodCount int) int {
+	interval := base - c.StepPerFood*foodCount
+	if interval < c.MinInterval {
+		interval = c.MinInterval
+	}
+	if interval > base {
+		interval = base
+	}
+	return interval
+}
+
+// Rules 游戏模式的规则
+type Rules struct {
+	Mode       string     `json:"mode"`
+	Speed      SpeedCurve `json:"speed"`
+	Starvation int        `json:"starvation"` // 超过多少秒没有吃到豆子会饿死，0表示不会饿死
+	TimeScore  int        `json:"timeScore"`  // 每存活一秒的得分
+	FoodScore  int        `json:"foodScore"`  // 每个豆子的得分
+	TimeLimit  int        `json:"timeLimit"`  // 游戏时长上限（秒），到时游戏结束，0表示不限
+	WallChance float64    `json:"wallChance"` // 15x15棋盘上每次更新生成墙体的概率，0表示不生成随机墙体
+	WallRamp   int        `json:"wallRamp"`   // 每经过多少秒，墙体生成概率和数量上限再增加一倍基准值，0表示不加速
+}
+
+// gameModes 各模式的规则
+var gameModes = map[string]Rules{
+	GameModeClassic: {
+		Speed:      SpeedCurve{StepPerFood: 5, MinInterval: 80},
+		Starvation: 10,
+		TimeScore:  1,
+		FoodScore:  10,
+		WallChance: 0.2,
+	},
+	GameModeSteady: {
+		Starvation: 10,
+		TimeScore:  1,
+		FoodScore:  10,
+		WallChance: 0.2,
+	},
+	GameModeTimeAttack: {
+		Speed:      SpeedCurve{StepPerFood: 5, MinInterval: 80},
+		FoodScore:  10,
+		TimeLimit:  60,
+		WallChance: 0.2,
+	},
+	GameModeZen: {
+		TimeScore: 1,
+		FoodScore: 10,
+	},
+	GameModeSurvival: {
+		Speed:      SpeedCurve{StepPerFood: 5, MinInterval: 80},
+		Starvation: 10,
+		TimeScore:  1,
+		FoodScore:  10,
+		WallChance: 0.2,
+		WallRamp:   30,
+	},
+}
+
+// IsValidMode 判断游戏模式是否存在
+func IsValidMode(mode string) bool {
+	_, ok := gameModes[mode]
+	return ok
+}
+
+// GetRules 获取游戏模式的规则，模式不存在时返回经典模式的规则
+func GetRules(mode string) Rules {
+	rules, ok := gameModes[mode]
+	if !ok {
+		mode, rules = GameModeClassic, gameModes[GameModeClassic]
+	}
+	rules.Mode = mode
+	return rules
+}
+
+// ListRules 按名称顺序列出所有游戏模式的规则
+func ListRules() []Rules {
+	list := make([]Rules, 0, len(gameModes))
+	for mode := range gameModes {
+		list = append(list, GetRules(mode))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Mode < list[j].Mode })
+	return list
+}
+
+// rules 本局游戏的规则
+func (g *Game) rules() Rules {
+	return GetRules(g.Mode)
+}
+
+// wallRampFactor 墙体加速的倍数，不加速时为1
+func (r Rules) wallRampFactor(elapsed int) int {
+	if r.WallRamp <= 0 {
+		return 1
+	}
+	return 1 + elapsed/r.WallRamp
+}
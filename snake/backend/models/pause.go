@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Active 游戏是否需要定时更新，即处于倒计时或运行中
+func (g *Game) Active() bool {
+	return g.Status == GameStatusCountdown || g.Status == GameStatusRunning
+}
+
+// Pause 暂停运行中的游戏，at为暂停时的系统时间
+// 暂停期间游戏时钟不推进，游戏时间、饥饿计时、墙体存活时间和效果时长都随之停止
+func (g *Game) Pause(snakeID int, at time.Time) bool {
+	snake := g.Snake(snakeID)
+	if g.Status != GameStatusRunning || snake == nil {
+		return false
+	}
+
+	snake.Pauses++
+	g.Status = GameStatusPaused
+	g.PausedBy = snakeID
+	g.PausedAt = at
+	g.emit(Event{Type: EventGamePaused, SnakeID: snakeID})
+	return true
+}
+
+// Resume 继续暂停的游戏，countdown为继续前的倒计时（秒），0表示立即继续
+// snakeID为发起继续的蛇，超时自动继续时为NoSnake
+func (g *Game) Resume(snakeID, countdown int) bool {
+	if g.Status != GameStatusPaused {
+		return false
+	}
+
+	g.Status = GameStatusRunning
+	if countdown > 0 {
+		g.Status = GameStatusCountdown
+		g.Countdown = countdown * 1000
+	}
+	g.PausedBy = NoSnake
+	g.PausedAt = time.Time{}
+	g.emit(Event{Type: EventGameResumed, SnakeID: snakeID})
+	return true
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// pausedState 暂停期间不应变化的状态
+type pausedState struct {
+	Tick      int64
+	Time      int
+	Now       time.Time
+	Countdown int
+	Effects   int
+	Walls     int
+}
+
+func pauseSnapshot(g *Game) pausedState {
+	remaining := 0
+	for _, e := range g.Snakes[0].Effects {
+		remaining += e.Remaining
+	}
+	return pausedState{g.Tick, g.Time, g.clock.Now(), g.Countdown, remaining, len(g.Walls)}
+}
+
+func TestPauseFreezesGame(t *testing.T) {
+	g := NewGame("a", GameOptions{Width: 15, Height: 15, Seed: 1, Mode: GameModeTimeAttack, TickInterval: 100}, NewTickClock(testStart))
+	g.spawnSnakes([]Spawn{{Position{X: 2, Y: 7}, Right}})
+	g.Food = Food{Position: Position{X: 0, Y: 0}, Type: FoodNormal}
+	g.Start()
+	g.applyFood(g.Snakes[0], Food{Type: FoodDouble})
+	g.Walls = []Wall{{Position: Position{X: 10, Y: 0}, CreatedAt: g.clock.Now(), Lifetime: 1}}
+	// 离时间上限只差一次更新
+	g.clock.Advance(time.Duration(g.rules().TimeLimit)*time.Second - 100*time.Millisecond)
+
+	if !g.Pause(0, testStart) {
+		t.Fatal("Pause() = false")
+	}
+	before := pauseSnapshot(g)
+	for i := 0; i < 50; i++ {
+		g.Update()
+	}
+	if g.Status != GameStatusPaused {
+		t.Fatalf("暂停期间 Status = %q", g.Status)
+	}
+	if after := pauseSnapshot(g); after != before {
+		t.Errorf("暂停期间状态变化 %+v -> %+v", before, after)
+	}
+
+	// 继续前的倒计时中游戏时间同样不推进
+	if !g.Resume(0, 1) {
+		t.Fatal("Resume() = false")
+	}
+	before = pauseSnapshot(g)
+	for i := 0; i < 9; i++ {
+		g.Update()
+	}
+	if g.Status != GameStatusCountdown {
+		t.Fatalf("倒计时中 Status = %q", g.Status)
+	}
+	after := pauseSnapshot(g)
+	if after.Countdown != before.Countdown-900 {
+		t.Errorf("Countdown = %d, want %d", after.Countdown, before.Countdown-900)
+	}
+	after.Countdown = before.Countdown
+	if after != before {
+		t.Errorf("倒计时中状态变化 %+v -> %+v", before, after)
+	}
+
+	// 倒计时结束后时间继续推进，到达时间上限
+	for g.Status == GameStatusCountdown {
+		g.Update()
+	}
+	g.Update()
+	if g.Status != GameStatusEnded || g.DeathCause != EndTimeUp {
+		t.Errorf("Status = %q, DeathCause = %q, want 时间用完结束", g.Status, g.DeathCause)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	g := NewGame("a", GameOptions{Width: 15, Height: 15, Seed: 1, Mode: GameModeZen, TickInterval: 100, Players: 2}, NewTickClock(testStart))
+	g.Start()
+
+	if g.Resume(0, 0) {
+		t.Error("运行中的游戏 Resume() = true")
+	}
+	if g.Pause(5, testStart) {
+		t.Error("不存在的蛇 Pause() = true")
+	}
+	if !g.Pause(1, testStart) {
+		t.Fatal("Pause() = false")
+	}
+	if g.PausedBy != 1 || !g.PausedAt.Equal(testStart) {
+		t.Errorf("PausedBy = %d, PausedAt = %v", g.PausedBy, g.PausedAt)
+	}
+	if g.Pause(0, testStart) {
+		t.Error("已暂停的游戏 Pause() = true")
+	}
+	if !g.Resume(NoSnake, 0) || g.Status != GameStatusRunning || g.PausedBy != NoSnake {
+		t.Fatalf("Resume 后 Status = %q, PausedBy = %d", g.Status, g.PausedBy)
+	}
+
+	// 暂停次数按蛇分别统计，由游戏管理器限制
+	g.Pause(1, testStart)
+	g.Resume(1, 0)
+	g.Pause(0, testStart)
+	if g.Snakes[0].Pauses != 1 || g.Snakes[1].Pauses != 2 {
+		t.Errorf("Pauses = %d, %d, want 1, 2", g.Snakes[0].Pauses, g.Snakes[1].Pauses)
+	}
+}
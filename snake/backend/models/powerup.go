@@ -0,0 +1,145 @@
+package models
+
+// 食物类型
+const (
+	FoodNormal = "normal" // 普通豆子
+	FoodSpeed  = "speed"  // 加速：游戏更新间隔缩短
+	FoodSlow   = "slow"   // 慢动作：游戏更新间隔延长
+	FoodShrink = "shrink" // 缩短尾巴，立即生效
+	FoodPhase  = "phase"  // 穿墙：可以穿过墙体，不能穿过边界和蛇身
+	FoodDouble = "double" // 双倍得分：期间吃到的豆子得分翻倍
+)
+
+// foodWeights 各类食物的生成权重，按顺序累加以保证相同随机数得到相同类型
+var foodWeights = []struct {
+	Type   string
+	Weight int
+}{
+	{FoodNormal, 80},
+	{FoodSpeed, 5},
+	{FoodSlow, 5},
+	{FoodShrink, 4},
+	{FoodPhase, 3},
+	{FoodDouble, 3},
+}
+
+// effectDurations 有持续时间的效果的时长（毫秒）
+var effectDurations = map[string]int{
+	FoodSpeed:  5000,
+	FoodSlow:   5000,
+	FoodPhase:  5000,
+	FoodDouble: 10000,
+}
+
+// 效果参数
+const (
+	speedFactor  = 0.6 // 加速时更新间隔的倍数
+	slowFactor   = 1.5 // 慢动作时更新间隔的倍数
+	minInterval  = 50  // 效果作用后更新间隔的下限（毫秒）
+	shrinkLength = 3   // 缩短尾巴时去掉的长度
+)
+
+// Effect 蛇身上正在生效的效果
+type Effect struct {
+	Type      string `json:"type"`
+	Remaining int    `json:"remaining"` // 剩余时长（毫秒）
+}
+
+// randomFoodType 按权重随机选择食物类型
+func (g *Game) randomFoodType() string {
+	total := 0
+	for _, w := range foodWeights {
+		total += w.Weight
+	}
+	n := g.rng.Intn(total)
+	for _, w := range foodWeights {
+		if n < w.Weight {
+			return w.Type
+		}
+		n -= w.Weight
+	}
+	return FoodNormal
+}
+
+// HasEffect 判断蛇身上是否有指定效果
+func (s *Snake) HasEffect(effect string) bool {
+	for _, e := range s.Effects {
+		if e.Type == effect {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFood 让吃到特殊食物的蛇获得效果
+// 有持续时间的效果重复获得时重新计时，缩短尾巴立即生效且蛇不会短于出生时的长度
+func (g *Game) applyFood(snake *Snake, food Food) {
+	if food.Type == FoodNormal || food.Type == "" {
+		return
+	}
+
+	if food.Type == FoodShrink {
+		keep := len(snake.Body) - shrinkLength
+		if keep < spawnLength {
+			keep = spawnLength
+		}
+		if keep < len(snake.Body) {
+			snake.Body = snake.Body[:keep]
+		}
+	} else {
+		duration := effectDurations[food.Type]
+		refreshed := false
+		for i := range snake.Effects {
+			if snake.Effects[i].Type == food.Type {
+				snake.Effects[i].Remaining = duration
+				refreshed = true
+			}
+		}
+		if !refreshed {
+			snake.Effects = append(snake.Effects, Effect{Type: food.Type, Remaining: duration})
+		}
+	}
+
+	pos := food.Position
+	g.emit(Event{Type: EventPowerUp, SnakeID: snake.ID, Position: &pos, Effect: food.Type})
+}
+
+// tickEffects 效果的剩余时长减去本次更新的间隔，移除到期的效果
+func (g *Game) tickEffects(elapsed int) {
+	for _, snake := range g.Snakes {
+		if len(snake.Effects) == 0 {
+			continue
+		}
+		var active []Effect
+		for _, e := range snake.Effects {
+			e.Remaining -= elapsed
+			if e.Remaining > 0 && snake.Alive {
+				active = append(active, e)
+			} else if snake.Alive {
+				g.emit(Event{Type: EventEffectExpired, SnakeID: snake.ID, Effect: e.Type})
+			}
+		}
+		snake.Effects = active
+	}
+}
+
+// updateTickInterval 按模式的速度曲线和存活的蛇身上的加速、慢动作效果计算更新间隔
+// 更新间隔是整局游戏共用的，任意一条蛇的效果都会影响所有蛇
+func (g *Game) updateTickInterval() {
+	interval := float64(g.rules().Speed.Interval(g.BaseTickInterval, g.FoodCount))
+	speed, slow := false, false
+	for _, snake := range g.aliveSnakes() {
+		speed = speed || snake.HasEffect(FoodSpeed)
+		slow = slow || snake.HasEffect(FoodSlow)
+	}
+	if speed {
+		interval *= speedFactor
+	}
+	if slow {
+		interval *= slowFactor
+	}
+	if interval < minInterval && g.BaseTickInterval >= minInterval {
+		interval = minInterval
+	}
+	g.TickInterval = int(interval)
+}
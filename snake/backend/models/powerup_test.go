@@ -0,0 +1,111 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+// powerUpGame 创建只有一条蛇的游戏，蛇身为body
+func powerUpGame(body []Position) *Game {
+	opts := GameOptions{Width: 15, Height: 15, Seed: 1, Mode: GameModeClassic, TickInterval: 100}
+	g := NewGame("a", opts, NewTickClock(testStart))
+	g.Snakes[0].Body = body
+	return g
+}
+
+func TestApplyFoodShrink(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  int
+		wantLen int
+	}{
+		{"出生长度", spawnLength, spawnLength},
+		{"比出生长度多一节", spawnLength + 1, spawnLength},
+		{"正好缩短到出生长度", spawnLength + shrinkLength, spawnLength},
+		{"足够长", spawnLength + shrinkLength + 2, spawnLength + 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b []Position
+			for x := tt.length; x > 0; x-- {
+				b = append(b, Position{X: x, Y: 1})
+			}
+			g := powerUpGame(b)
+			snake := g.Snakes[0]
+
+			g.applyFood(snake, Food{Type: FoodShrink})
+			if len(snake.Body) != tt.wantLen {
+				t.Fatalf("长度 = %d, want %d", len(snake.Body), tt.wantLen)
+			}
+			// 去掉的是尾巴，蛇头不变
+			if !reflect.DeepEqual(snake.Body, b[:tt.wantLen]) {
+				t.Errorf("Body = %v, want %v", snake.Body, b[:tt.wantLen])
+			}
+			if len(snake.Effects) != 0 {
+				t.Errorf("缩短尾巴不应留下效果: %v", snake.Effects)
+			}
+		})
+	}
+}
+
+func TestApplyFoodDuration(t *testing.T) {
+	tests := []struct {
+		food string
+		want int
+	}{
+		{FoodSpeed, 5000},
+		{FoodSlow, 5000},
+		{FoodPhase, 5000},
+		{FoodDouble, 10000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.food, func(t *testing.T) {
+			g := powerUpGame(body(3, 1, 2, 1, 1, 1))
+			snake := g.Snakes[0]
+
+			g.applyFood(snake, Food{Type: tt.food})
+			if want := []Effect{{Type: tt.food, Remaining: tt.want}}; !reflect.DeepEqual(snake.Effects, want) {
+				t.Fatalf("Effects = %v, want %v", snake.Effects, want)
+			}
+
+			// 效果期间再次吃到同类食物时重新计时，不叠加
+			g.tickEffects(1000)
+			g.applyFood(snake, Food{Type: tt.food})
+			if want := []Effect{{Type: tt.food, Remaining: tt.want}}; !reflect.DeepEqual(snake.Effects, want) {
+				t.Errorf("重复获得后 Effects = %v, want %v", snake.Effects, want)
+			}
+		})
+	}
+}
+
+func TestPhaseExpiry(t *testing.T) {
+	g := powerUpGame(body(3, 1, 2, 1, 1, 1))
+	snake := g.Snakes[0]
+	g.Walls = []Wall{{Position: Position{X: 4, Y: 1}, Permanent: true}}
+	g.applyFood(snake, Food{Type: FoodPhase})
+
+	// 穿墙期间撞到墙体不会死亡
+	moved := &Snake{ID: 0, Body: body(4, 1, 3, 1, 2, 1, 1, 1), Alive: true, Effects: snake.Effects}
+	if got := g.CheckCollisions([]*Snake{moved}); len(got) != 0 {
+		t.Fatalf("穿墙期间 CheckCollisions() = %v, want 无碰撞", got)
+	}
+
+	g.tickEffects(effectDurations[FoodPhase] - 1)
+	if !snake.HasEffect(FoodPhase) {
+		t.Fatal("穿墙效果提前到期")
+	}
+	g.tickEffects(1)
+	if snake.HasEffect(FoodPhase) {
+		t.Fatal("穿墙效果没有到期")
+	}
+	last := g.Events[len(g.Events)-1]
+	if last.Type != EventEffectExpired || last.Effect != FoodPhase || last.SnakeID != snake.ID {
+		t.Errorf("最后的事件 = %+v, want 穿墙效果到期", last)
+	}
+
+	// 到期后撞到墙体死亡
+	moved.Effects = snake.Effects
+	if got := g.CheckCollisions([]*Snake{moved}); got[0] != DeathWall {
+		t.Errorf("到期后 CheckCollisions() = %v, want %v", got, DeathWall)
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// ReplayInput 一次被接受的方向变化
+// Tick为收到输入时游戏已执行的更新次数，输入在第Tick+1次更新前进入转向队列
+type ReplayInput struct {
+	Tick      int64     `json:"tick"`
+	SnakeID   int       `json:"snakeId"`
+	Direction Direction `json:"direction"`
+}
+
+// Replay 游戏录像，包含复现一局游戏所需的全部信息
+type Replay struct {
+	GameID string `json:"gameId"`
+	GameOptions
+	StartTime time.Time     `json:"startTime"`
+	Inputs    []ReplayInput `json:"inputs"`
+	Ticks     int64         `json:"ticks"` // 录像覆盖的更新次数
+}
+
+// Replay 生成当前游戏的录像
+// 只有使用TickClock的游戏才能被精确复现
+func (g *Game) Replay() Replay {
+	return Replay{
+		GameID:      g.ID,
+		GameOptions: g.Options(),
+		StartTime:   g.CreatedAt,
+		Inputs:      append([]ReplayInput{}, g.inputs...),
+		Ticks:       g.Tick,
+	}
+}
+
+// Run 按录像重新运行游戏，返回初始状态及每次更新后的状态
+// 游戏结束或达到录像的更新次数时停止
+func (r *Replay) Run() []Game {
+	game := NewGame(r.GameID, r.GameOptions, NewTickClock(r.StartTime))
+	// 多人游戏在所有玩家加入后开始，加入不影响游戏状态，录像中直接开始
+	// 倒计时和暂停期间游戏时钟不推进，也不计入更新次数，录像中跳过
+	game.Start()
+	game.Status, game.Countdown = GameStatusRunning, 0
+
+	states := []Game{game.Clone()}
+	next := 0
+	for game.Status == GameStatusRunning && game.Tick < r.Ticks {
+		// 应用本次更新前收到的输入
+		for next < len(r.Inputs) && r.Inputs[next].Tick <= game.Tick {
+			game.ChangeDirection(r.Inputs[next].SnakeID, r.Inputs[next].Direction)
+			next++
+		}
+
+		game.Update()
+		states = append(states, game.Clone())
+	}
+
+	return states
+}
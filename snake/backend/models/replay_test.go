@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+// playBot 让机器人控制蛇运行最多ticks次更新，机器人的失误使用固定种子，结果可以复现
+func playBot(g *Game, ticks int64, difficulty string) {
+	for _, snake := range g.Snakes {
+		snake.Bot = difficulty
+	}
+	rng := rand.New(rand.NewSource(1))
+	for g.Status == GameStatusRunning && g.Tick < ticks {
+		for _, snake := range g.Snakes {
+			if d, ok := g.BotDirection(snake.ID, rng); ok {
+				g.ChangeDirection(snake.ID, d)
+			}
+		}
+		g.Update()
+	}
+}
+
+// mustJSON 序列化游戏的公开状态，用于比较两局游戏是否相同
+func mustJSON(t *testing.T, g *Game) string {
+	t.Helper()
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestReplayRun(t *testing.T) {
+	tests := []struct {
+		name string
+		opts GameOptions
+		bot  string
+	}{
+		{"经典模式", GameOptions{Width: 15, Height: 15, MaxWalls: 5, Seed: 42, Mode: GameModeClassic, TickInterval: 100}, BotHard},
+		{"生存模式", GameOptions{Width: 20, Height: 12, MaxWalls: 10, Seed: 7, Mode: GameModeSurvival, TickInterval: 100}, BotNormal},
+		{"多人游戏", GameOptions{Width: 15, Height: 15, MaxWalls: 5, Seed: 3, Mode: GameModeSteady, TickInterval: 100, Players: 2}, BotHard},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := NewGame("replay", tt.opts, NewTickClock(testStart))
+			game.Start()
+			playBot(game, 400, tt.bot)
+			if game.Tick == 0 {
+				t.Fatal("游戏没有运行")
+			}
+
+			replay := game.Replay()
+			states := replay.Run()
+			if got := int64(len(states) - 1); got != game.Tick {
+				t.Fatalf("回放了%d次更新, want %d", got, game.Tick)
+			}
+			last := states[len(states)-1]
+			// 机器人难度只影响录像之外的方向选择
+			for _, snake := range last.Snakes {
+				snake.Bot = tt.bot
+			}
+			if got, want := mustJSON(t, &last), mustJSON(t, game); got != want {
+				t.Errorf("回放的最终状态与原游戏不同\n got: %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
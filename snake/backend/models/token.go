@@ -0,0 +1,56 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// hashToken 计算控制令牌的摘要，游戏中只保存摘要
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Join 把控制令牌分配给第一条还没有玩家的蛇，返回蛇ID
+// playerID为登录玩家的ID，游客为0；所有蛇都有玩家后游戏开始；没有空位时返回false
+func (g *Game) Join(token string, playerID int64) (int, bool) {
+	for _, snake := range g.Snakes {
+		if snake.Joined {
+			continue
+		}
+		snake.Joined = true
+		snake.controlTokenHash = hashToken(token)
+		snake.PlayerID = playerID
+		if g.full() {
+			g.Start()
+		}
+		return snake.ID, true
+	}
+	return 0, false
+}
+
+// full 是否所有蛇都已有玩家
+func (g *Game) full() bool {
+	for _, snake := range g.Snakes {
+		if !snake.Joined {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckControlToken 校验控制令牌，返回令牌对应的蛇ID
+// 只有持有令牌的玩家才能操作对应的蛇
+func (g *Game) CheckControlToken(token string) (int, bool) {
+	if token == "" {
+		return 0, false
+	}
+	hash := []byte(hashToken(token))
+	for _, snake := range g.Snakes {
+		if snake.controlTokenHash != "" && subtle.ConstantTimeCompare(hash, []byte(snake.controlTokenHash)) == 1 {
+			return snake.ID, true
+		}
+	}
+	return 0, false
+}
@@ -11,6 +11,9 @@ import (
 func InitRouter() {
 	// 创建控制器实例
 	gameController := &controllers.GameController{}
+	lobbyController := &controllers.LobbyController{}
+	levelController := &controllers.LevelController{}
+	playerController := &controllers.PlayerController{}
 
 	// 设置CORS中间件
 	beego.InsertFilter("*", beego.BeforeRouter, corsHandler())
@@ -18,9 +21,35 @@ func InitRouter() {
 	// 注册路由
 	beego.Router("/api/game", gameController, "post:NewGame")
 	beego.Router("/api/game/:id", gameController, "get:GetGame")
+	beego.Router("/api/game/:id/join", gameController, "post:JoinGame")
+	beego.Router("/api/game/:id/bots", gameController, "post:AddBot")
+	beego.Router("/api/game/:id/replay", gameController, "get:GetReplay")
+	beego.Router("/api/game/:id/ws", gameController, "get:GameSocket")
 	beego.Router("/api/game/:id/direction", gameController, "post:UpdateDirection")
+	beego.Router("/api/game/:id/pause", gameController, "post:PauseGame")
+	beego.Router("/api/game/:id/resume", gameController, "post:ResumeGame")
 	beego.Router("/api/game/:id/record", gameController, "post:SaveRecord")
+	beego.Router("/api/modes", gameController, "get:GetModes")
 	beego.Router("/api/leaderboard", gameController, "get:GetLeaderboard")
+	beego.Router("/api/leaderboard/rank", gameController, "get:GetLeaderboardRank")
+
+	// 多人游戏大厅
+	beego.Router("/api/rooms", lobbyController, "get:ListRooms;post:CreateRoom")
+	beego.Router("/api/rooms/match", lobbyController, "post:Match")
+	beego.Router("/api/rooms/:id", lobbyController, "get:GetRoom")
+	beego.Router("/api/rooms/:id/join", lobbyController, "post:JoinRoom")
+	beego.Router("/api/rooms/:id/ready", lobbyController, "post:Ready")
+	beego.Router("/api/rooms/:id/leave", lobbyController, "post:LeaveRoom")
+
+	// 玩家账号
+	beego.Router("/api/players/register", playerController, "post:Register")
+	beego.Router("/api/players/login", playerController, "post:Login")
+	beego.Router("/api/players/me", playerController, "get:GetMe")
+	beego.Router("/api/players/claim", playerController, "post:ClaimRecords")
+
+	// 关卡编辑
+	beego.Router("/api/levels", levelController, "get:ListLevels;post:CreateLevel")
+	beego.Router("/api/levels/:name", levelController, "get:GetLevel;put:UpdateLevel;delete:DeleteLevel")
 }
 
 // corsHandler CORS中间件
@@ -29,7 +58,7 @@ func corsHandler() beego.FilterFunc {
 		// 设置CORS头信息
 		ctx.Output.Header("Access-Control-Allow-Origin", "*")
 		ctx.Output.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		ctx.Output.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+		ctx.Output.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, X-Control-Token, X-Player-Token, Authorization")
 		ctx.Output.Header("Access-Control-Allow-Credentials", "true")
 
 		// 处理预检请求
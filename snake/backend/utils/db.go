@@ -5,7 +5,7 @@ import (
 	"log"
 
 	"github.com/astaxie/beego"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 var DB *sql.DB
@@ -48,12 +48,138 @@ func createTables() {
 		time_played INTEGER NOT NULL,
 		food_count INTEGER NOT NULL,
 		player_name VARCHAR(100),
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 	)
 	`)
 	if err != nil {
 		log.Printf("Failed to create game_records table: %v\n", err)
 	}
+
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS game_id VARCHAR(100)`)
+	if err != nil {
+		log.Printf("Failed to add game_id column: %v\n", err)
+	}
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS snake_id INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		log.Printf("Failed to add snake_id column: %v\n", err)
+	}
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS death_cause VARCHAR(20)`)
+	if err != nil {
+		log.Printf("Failed to add death_cause column: %v\n", err)
+	}
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS level VARCHAR(50) NOT NULL DEFAULT ''`)
+	if err != nil {
+		log.Printf("Failed to add level column: %v\n", err)
+	}
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS level_version INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		log.Printf("Failed to add level_version column: %v\n", err)
+	}
+	// 之前的游戏都在15x15的棋盘上进行
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS board_width INTEGER NOT NULL DEFAULT 15`)
+	if err != nil {
+		log.Printf("Failed to add board_width column: %v\n", err)
+	}
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS board_height INTEGER NOT NULL DEFAULT 15`)
+	if err != nil {
+		log.Printf("Failed to add board_height column: %v\n", err)
+	}
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS mode VARCHAR(20) NOT NULL DEFAULT 'classic'`)
+	if err != nil {
+		log.Printf("Failed to add mode column: %v\n", err)
+	}
+
+	// 创建玩家表，名称不区分大小写
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS players (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(20) NOT NULL,
+		password_hash VARCHAR(100) NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	)
+	`)
+	if err != nil {
+		log.Printf("Failed to create players table: %v\n", err)
+	}
+	_, err = DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS players_name_idx ON players (LOWER(name))`)
+	if err != nil {
+		log.Printf("Failed to create players index: %v\n", err)
+	}
+
+	// 注册玩家的成绩关联玩家ID；游客的成绩保存认领令牌的摘要，注册后可以认领
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS player_id INTEGER REFERENCES players (id)`)
+	if err != nil {
+		log.Printf("Failed to add player_id column: %v\n", err)
+	}
+	_, err = DB.Exec(`ALTER TABLE game_records ADD COLUMN IF NOT EXISTS claim_hash VARCHAR(64)`)
+	if err != nil {
+		log.Printf("Failed to add claim_hash column: %v\n", err)
+	}
+	_, err = DB.Exec(`CREATE INDEX IF NOT EXISTS game_records_claim_hash_idx ON game_records (claim_hash)`)
+	if err != nil {
+		log.Printf("Failed to create claim_hash index: %v\n", err)
+	}
+
+	// 每局游戏的每条蛇只允许提交一次成绩
+	_, err = DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS game_records_game_snake_idx ON game_records (game_id, snake_id)`)
+	if err != nil {
+		log.Printf("Failed to create game_records index: %v\n", err)
+	}
+
+	// 创建关卡表，每次保存新增一个版本，删除时只做标记
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS levels (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(50) NOT NULL,
+		version INTEGER NOT NULL,
+		map TEXT NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		deleted_at TIMESTAMPTZ,
+		UNIQUE (name, version)
+	)
+	`)
+	if err != nil {
+		log.Printf("Failed to create levels table: %v\n", err)
+	}
+	// 关卡的创建者，每个版本都记录创建者，之前保存的关卡没有创建者
+	_, err = DB.Exec(`ALTER TABLE levels ADD COLUMN IF NOT EXISTS player_id INTEGER REFERENCES players (id)`)
+	if err != nil {
+		log.Printf("Failed to add levels player_id column: %v\n", err)
+	}
+
+	// 之前的时间列不带时区，lib/pq会把读出的时间当作UTC，排行榜按时区划分周期时会错位
+	migrateTimestamp("game_records", "created_at")
+	migrateTimestamp("players", "created_at")
+	migrateTimestamp("levels", "created_at")
+	migrateTimestamp("levels", "deleted_at")
+}
+
+// migrateTimestamp 把不带时区的TIMESTAMP列改为TIMESTAMPTZ
+// 旧值由CURRENT_TIMESTAMP按数据库会话的时区写入，因此按同一时区解释
+func migrateTimestamp(table, column string) {
+	var dataType string
+	err := DB.QueryRow(
+		"SELECT data_type FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2",
+		table, column,
+	).Scan(&dataType)
+	if err != nil {
+		log.Printf("Failed to read %s.%s column type: %v\n", table, column, err)
+		return
+	}
+	if dataType != "timestamp without time zone" {
+		return
+	}
+
+	_, err = DB.Exec(`ALTER TABLE ` + table + ` ALTER COLUMN ` + column + ` TYPE TIMESTAMPTZ USING ` + column + ` AT TIME ZONE current_setting('TimeZone')`)
+	if err != nil {
+		log.Printf("Failed to migrate %s.%s to TIMESTAMPTZ: %v\n", table, column, err)
+	}
+}
+
+// IsUniqueViolation 判断错误是否为唯一约束冲突
+func IsUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
 }
 
 // CloseDB 关闭数据库连接
@@ -2,6 +2,10 @@ package utils
 
 import (
 	"blockcade/models"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mathrand "math/rand"
 	"sync"
 	"time"
 
@@ -10,26 +14,95 @@ import (
 
 // GameManager 游戏管理器
 type GameManager struct {
-	games    map[string]*models.Game
-	mutex    sync.RWMutex
-	width    int
-	height   int
-	maxWalls int
-	speed    int
+	games       map[string]*models.Game                  // 由本实例负责更新的游戏
+	schedules   map[string]*gameSchedule                 // 本实例负责的游戏的更新计划
+	store       GameStore                                // 游戏状态存储
+	shared      SharedGameStore                          // 多实例共享的存储，内存存储时为nil
+	instanceID  string                                   // 本实例标识，用于游戏租约
+	subscribers map[string]map[chan models.Game]struct{} // 订阅游戏状态推送的连接
+	botRNGs     map[string]*mathrand.Rand                // 机器人模拟失误用的随机数，与游戏自身的随机数分开
+	writes      map[string]*storeWrite                   // 等待在锁外写入共享存储的操作
+	flushing    map[string]*storeWrite                   // 正在写入共享存储的操作
+	mutex       sync.RWMutex
+	storeMutex  sync.Mutex    // 在锁外写入共享存储时，保证写入顺序与游戏状态变化的顺序一致
+	width       int           // 默认棋盘宽度
+	height      int           // 默认棋盘高度
+	minSize     int           // 允许请求的最小棋盘边长
+	maxSize     int           // 允许请求的最大棋盘边长
+	maxWalls    int           // 15x15棋盘上的墙体数量上限，其他大小按面积缩放
+	speed       int           // 默认的初始更新间隔（毫秒）
+	countdown   int           // 开始和继续前的倒计时（秒）
+	maxPauses   int           // 每位玩家每局最多暂停的次数
+	maxPause    time.Duration // 单次暂停的最长时间，超过后自动继续，0表示不限
+	runningTTL  time.Duration // 运行中的游戏无活动多久后移除
+	endedTTL    time.Duration // 已结束的游戏无活动多久后移除
+
+	lifecycleMutex sync.Mutex
+	stopCh         chan struct{} // 关闭时通知更新循环退出，未启动时为nil
+	doneCh         chan struct{} // 更新循环退出后关闭
+}
+
+// gameSchedule 单局游戏的更新计划
+type gameSchedule struct {
+	nextUpdate     time.Time // 下一次更新的时间
+	leaseRenewedAt time.Time // 上一次续期租约的时间
 }
 
+const (
+	schedulerInterval  = 10 * time.Millisecond // 调度循环的检查间隔，决定更新间隔的精度
+	gameLeaseTTL       = 5 * time.Second       // 游戏租约时长，实例退出后其他实例可在此之后接管
+	gameLeaseRenewal   = time.Second           // 续期租约的间隔
+	gameStoreTTLMargin = 5 * time.Minute       // 存储中游戏状态比游戏的保留时长多保留的时间
+	expiredRetention   = time.Hour             // 游戏移除后仍能识别为“已过期”的时长
+)
+
+// 游戏移除原因
+const (
+	expireReasonIdle  = "idle"  // 运行中的游戏长时间无活动
+	expireReasonEnded = "ended" // 已结束的游戏超过保留时长
+)
+
+// 成绩提交相关错误
+var (
+	ErrGameNotFound  = errors.New("游戏不存在")
+	ErrGameExpired   = errors.New("游戏已过期")
+	ErrGameNotEnded  = errors.New("游戏尚未结束，不能提交成绩")
+	ErrRecordExists  = errors.New("该游戏的成绩已提交过")
+	ErrScoreMismatch = errors.New("提交的得分与服务器记录不一致")
+	ErrCustomSeed    = errors.New("指定随机种子的游戏不计入排行榜")
+	ErrInvalidToken  = errors.New("控制令牌无效")
+	ErrGameFull      = errors.New("游戏已开始或没有空位")
+	ErrGameRemote    = errors.New("游戏由其他服务实例负责，请稍后重试")
+	ErrNotRunning    = errors.New("游戏不在进行中，不能暂停")
+	ErrNotPaused     = errors.New("游戏没有暂停")
+	ErrPauseLimit    = errors.New("暂停次数已用完")
+)
+
 var gameManager *GameManager
 var once sync.Once
 
 // GetGameManager 获取游戏管理器单例
 func GetGameManager() *GameManager {
 	once.Do(func() {
-		width := 15  // 固定为15，不允许修改
-		height := 15 // 固定为15，不允许修改
-		maxWalls := 6 // 最多6道墙，符合需求
+		minSize := beego.AppConfig.DefaultInt("game.size.min", 10)
+		maxSize := beego.AppConfig.DefaultInt("game.size.max", 40)
+		if minSize < models.MinBoardSize {
+			minSize = models.MinBoardSize
+		}
+		if maxSize > models.MaxBoardSize {
+			maxSize = models.MaxBoardSize
+		}
+		width := clampInt(beego.AppConfig.DefaultInt("game.width", 15), minSize, maxSize)
+		height := clampInt(beego.AppConfig.DefaultInt("game.height", 15), minSize, maxSize)
+		maxWalls := 6 // 15x15棋盘上最多6道墙
 		speed := 200
+		runningTTL := beego.AppConfig.DefaultInt("game.ttl.running", 300) // 秒
+		endedTTL := beego.AppConfig.DefaultInt("game.ttl.ended", 600)     // 秒
+		countdown := beego.AppConfig.DefaultInt("game.countdown", 3)      // 秒
+		maxPauses := beego.AppConfig.DefaultInt("game.pause.max", 3)
+		maxPause := beego.AppConfig.DefaultInt("game.pause.duration", 60) // 秒
 
-		// 从配置文件读取配置（除了width和height）
+		// 从配置文件读取配置
 		if mw := beego.AppConfig.String("wall.max"); mw != "" {
 			maxWalls, _ = beego.AppConfig.Int("wall.max")
 		}
@@ -38,86 +111,971 @@ func GetGameManager() *GameManager {
 		}
 
 		gameManager = &GameManager{
-			games:    make(map[string]*models.Game),
-			width:    width,
-			height:   height,
-			maxWalls: maxWalls,
-			speed:    speed,
+			games:       make(map[string]*models.Game),
+			schedules:   make(map[string]*gameSchedule),
+			store:       newGameStore(gameStoreTTL(runningTTL, endedTTL)),
+			instanceID:  newInstanceID(),
+			subscribers: make(map[string]map[chan models.Game]struct{}),
+			botRNGs:     make(map[string]*mathrand.Rand),
+			writes:      make(map[string]*storeWrite),
+			width:       width,
+			height:      height,
+			minSize:     minSize,
+			maxSize:     maxSize,
+			maxWalls:    maxWalls,
+			speed:       speed,
+			countdown:   countdown,
+			maxPauses:   maxPauses,
+			maxPause:    time.Duration(maxPause) * time.Second,
+			runningTTL:  time.Duration(runningTTL) * time.Second,
+			endedTTL:    time.Duration(endedTTL) * time.Second,
 		}
+		gameManager.shared, _ = gameManager.store.(SharedGameStore)
 
-		// 启动游戏更新循环
-		go gameManager.startUpdateLoop()
+		// 恢复存储中的游戏
+		gameManager.restoreGames()
 	})
 
 	return gameManager
 }
 
-// CreateGame 创建新游戏
-func (gm *GameManager) CreateGame(gameID string) *models.Game {
+// gameStoreTTL 存储中游戏状态的过期时间，由运行中和已结束游戏的保留时长（秒）中较长的一个加上余量得到
+// 游戏总是先按保留时长被管理器标记为已过期，之后读取返回ErrGameExpired，而不是因存储过期变成不存在
+func gameStoreTTL(runningTTL, endedTTL int) time.Duration {
+	return time.Duration(max(runningTTL, endedTTL))*time.Second + gameStoreTTLMargin
+}
+
+// newGameStore 根据配置创建游戏存储（game.store = memory | redis），ttl为Redis中游戏状态的过期时间
+func newGameStore(ttl time.Duration) GameStore {
+	if beego.AppConfig.DefaultString("game.store", "memory") == "redis" {
+		if RedisClient != nil && RedisClient.Ping(Ctx).Err() == nil {
+			beego.Info("Using Redis game store")
+			return NewRedisGameStore(RedisClient, ttl)
+		}
+		beego.Warn("Redis unavailable, falling back to memory game store")
+	}
+	return NewMemoryGameStore()
+}
+
+// randomHex 生成n字节的加密安全随机数，以十六进制返回
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// newInstanceID 生成随机的实例标识
+func newInstanceID() string {
+	return randomHex(8)
+}
+
+// NewGameID 生成不可猜测的游戏ID
+func NewGameID() string {
+	return randomHex(16)
+}
+
+// restoreGames 加载存储中可由本实例接管的游戏
+func (gm *GameManager) restoreGames() {
+	ids, err := gm.store.IDs()
+	if err != nil {
+		beego.Error("Failed to list stored games:", err)
+		return
+	}
+
+	for _, gameID := range ids {
+		stored := gm.fetch(gameID)
+		gm.mutex.Lock()
+		_, local, err := gm.lookup(gameID, stored)
+		gm.mutex.Unlock()
+		if err != nil && err != ErrGameNotFound && err != ErrGameExpired {
+			beego.Error("Failed to restore game:", gameID, err)
+		} else if local {
+			beego.Info("Restored game", gameID)
+		}
+	}
+}
+
+// storedGame 在锁外从共享存储读取的游戏，交给lookup使用
+type storedGame struct {
+	game  *models.Game
+	owned bool // 是否已获取租约，获取后由本实例负责更新
+	err   error
+}
+
+// fetch 在锁外尝试接管共享存储中的游戏，无法接管时读取只读快照
+// 使用内存存储或游戏已由本实例负责时不需要读取，返回nil
+func (gm *GameManager) fetch(gameID string) *storedGame {
+	if gm.shared == nil {
+		return nil
+	}
+	gm.mutex.RLock()
+	_, exists := gm.games[gameID]
+	gm.mutex.RUnlock()
+	if exists {
+		return nil
+	}
+
+	owned, err := gm.shared.Acquire(gameID, gm.instanceID, gameLeaseTTL)
+	if err != nil {
+		return &storedGame{err: err}
+	}
+	game, err := gm.store.Load(gameID)
+	if err != nil && owned {
+		gm.shared.Release(gameID, gm.instanceID)
+		owned = false
+	}
+	return &storedGame{game: game, owned: owned, err: err}
+}
+
+// lookup 查找游戏（调用方需持有锁），stored为加锁前fetch的结果
+// 优先返回本实例负责的游戏；否则接管fetch读到的游戏，无法接管时返回只读快照，local为false
+// 游戏不存在时返回ErrGameNotFound，已因过期被移除时返回ErrGameExpired
+func (gm *GameManager) lookup(gameID string, stored *storedGame) (*models.Game, bool, error) {
+	if game, exists := gm.games[gameID]; exists {
+		return game, true, nil
+	}
+	// 移除操作尚未写入存储时，fetch可能仍读到游戏
+	for _, writes := range []map[string]*storeWrite{gm.writes, gm.flushing} {
+		if write := writes[gameID]; write != nil && write.removed != nil {
+			return nil, false, write.removed
+		}
+	}
+
+	var game *models.Game
+	var err error
+	owned := true
+	switch {
+	case gm.shared == nil:
+		game, err = gm.store.Load(gameID)
+	case stored == nil:
+		// fetch时游戏还由本实例负责，之后租约被其他实例接管
+		return nil, false, ErrGameRemote
+	default:
+		game, owned, err = stored.game, stored.owned, stored.err
+	}
+	if err != nil {
+		if err != ErrGameNotFound && err != ErrGameExpired {
+			beego.Error("Failed to load game:", gameID, err)
+			err = ErrGameNotFound
+		}
+		return nil, false, err
+	}
+	if !owned {
+		return game, false, nil
+	}
+	gm.track(game)
+	return game, true, nil
+}
+
+// touch 记录玩家活动，推迟游戏的过期时间（调用方需持有锁）
+// 游戏由其他实例负责时，活动时间写入共享存储，由负责的实例定期读取
+func (gm *GameManager) touch(game *models.Game, local bool) {
+	game.LastActivityAt = time.Now()
+	if !local {
+		gm.pendingWrite(game.ID).activity = game.LastActivityAt
+		return
+	}
+	// 倒计时和运行中的游戏每次更新都会保存，其余状态的游戏需要单独保存
+	if !game.Active() {
+		gm.save(game)
+	}
+}
+
+// track 开始由本实例负责更新游戏（调用方需持有锁）
+func (gm *GameManager) track(game *models.Game) {
+	gm.games[game.ID] = game
+	gm.schedules[game.ID] = &gameSchedule{
+		nextUpdate:     time.Now().Add(time.Duration(game.TickInterval) * time.Millisecond),
+		leaseRenewedAt: time.Now(),
+	}
+}
+
+// untrack 停止由本实例负责更新游戏（调用方需持有锁）
+func (gm *GameManager) untrack(gameID string) {
+	delete(gm.games, gameID)
+	delete(gm.schedules, gameID)
+	delete(gm.botRNGs, gameID)
+	gm.closeSubscribers(gameID)
+}
+
+// storeWrite 等待在锁外写入共享存储的操作，同一局游戏只保留最新的状态
+type storeWrite struct {
+	state     []byte        // 要保存的完整状态，为nil表示不需要保存
+	removed   error         // 游戏被删除时为ErrGameNotFound，因过期移除时为ErrGameExpired
+	retention time.Duration // 过期记录的保留时长
+	release   bool          // 写入后释放租约
+	activity  time.Time     // 由其他实例负责的游戏上的玩家活动时间，为零值表示没有
+}
+
+// pendingWrite 返回游戏等待写入的操作（调用方需持有锁）
+func (gm *GameManager) pendingWrite(gameID string) *storeWrite {
+	write := gm.writes[gameID]
+	if write == nil {
+		write = &storeWrite{}
+		gm.writes[gameID] = write
+	}
+	return write
+}
+
+// save 将游戏写入存储（调用方需持有锁）
+// 使用共享存储时只序列化状态，由flushWrites在锁外写入
+func (gm *GameManager) save(game *models.Game) {
+	if gm.shared == nil {
+		if err := gm.store.Save(game); err != nil {
+			beego.Error("Failed to save game:", game.ID, err)
+		}
+		return
+	}
+
+	data, err := game.MarshalState()
+	if err != nil {
+		beego.Error("Failed to save game:", game.ID, err)
+		return
+	}
+	gm.pendingWrite(game.ID).state = data
+}
+
+// forget 从本实例和存储中移除游戏（调用方需持有锁）
+func (gm *GameManager) forget(gameID string) {
+	gm.untrack(gameID)
+	if gm.shared == nil {
+		if err := gm.store.Delete(gameID); err != nil {
+			beego.Error("Failed to delete game:", gameID, err)
+		}
+		return
+	}
+	gm.writes[gameID] = &storeWrite{removed: ErrGameNotFound, release: true}
+}
+
+// expire 因过期移除游戏，之后读取该游戏会得到ErrGameExpired（调用方需持有锁）
+func (gm *GameManager) expire(gameID, reason string) {
+	beego.Info("Removing expired game", gameID, "reason:", reason)
+	gm.untrack(gameID)
+	if gm.shared == nil {
+		if err := gm.store.Expire(gameID, expiredRetention); err != nil {
+			beego.Error("Failed to expire game:", gameID, err)
+		}
+		return
+	}
+	gm.writes[gameID] = &storeWrite{removed: ErrGameExpired, retention: expiredRetention, release: true}
+}
+
+// flushWrites 在锁外把等待的操作写入共享存储，修改游戏的方法在释放锁后调用
+// 写入期间持有storeMutex，先取出的操作总是先写入，存储中的状态不会被旧状态覆盖
+func (gm *GameManager) flushWrites() {
+	if gm.shared == nil {
+		return
+	}
+	gm.storeMutex.Lock()
+	defer gm.storeMutex.Unlock()
+
+	gm.mutex.Lock()
+	writes := gm.writes
+	gm.writes, gm.flushing = make(map[string]*storeWrite), writes
+	gm.mutex.Unlock()
+	if len(writes) == 0 {
+		return
+	}
+	defer func() {
+		gm.mutex.Lock()
+		gm.flushing = nil
+		gm.mutex.Unlock()
+	}()
+
+	states := make(map[string][]byte)
+	for gameID, write := range writes {
+		if write.state != nil {
+			states[gameID] = write.state
+		}
+	}
+	if len(states) > 0 {
+		if err := gm.shared.SaveStates(states); err != nil {
+			beego.Error("Failed to save games:", err)
+		}
+	}
+
+	for gameID, write := range writes {
+		var err error
+		switch write.removed {
+		case ErrGameNotFound:
+			err = gm.store.Delete(gameID)
+		case ErrGameExpired:
+			err = gm.store.Expire(gameID, write.retention)
+		}
+		if err != nil {
+			beego.Error("Failed to remove game:", gameID, err)
+		}
+		if !write.activity.IsZero() {
+			if err := gm.shared.Touch(gameID, write.activity); err != nil {
+				beego.Error("Failed to record game activity:", gameID, err)
+			}
+		}
+		if write.release {
+			if err := gm.shared.Release(gameID, gm.instanceID); err != nil {
+				beego.Error("Failed to release game lease:", gameID, err)
+			}
+		}
+	}
+}
+
+// expireReason 返回游戏应被移除的原因，不需要移除时返回空字符串
+func (gm *GameManager) expireReason(game *models.Game, now time.Time) string {
+	idle := now.Sub(game.LastActivityAt)
+	if game.Status != models.GameStatusEnded {
+		if idle > gm.runningTTL {
+			return expireReasonIdle
+		}
+		return ""
+	}
+	if idle > gm.endedTTL {
+		return expireReasonEnded
+	}
+	return ""
+}
+
+// clampInt 将v限制在[min, max]范围内
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// BoardSizeRange 返回允许请求的棋盘边长范围
+func (gm *GameManager) BoardSizeRange() (int, int) {
+	return gm.minSize, gm.maxSize
+}
+
+// DefaultBoardSize 返回默认的棋盘大小
+func (gm *GameManager) DefaultBoardSize() (int, int) {
+	return gm.width, gm.height
+}
+
+// CreateGame 创建新游戏，返回游戏状态的副本及创建者的控制令牌，创建者控制ID为0的蛇
+// playerID为创建者的注册玩家ID，游客为0
+// opts中未指定的棋盘大小、墙体数量和初始更新间隔使用服务器配置，墙体数量按棋盘面积缩放；
+// 棋盘大小会被限制在允许的范围内，使用关卡时以关卡为准
+// 多人游戏在其他玩家通过JoinGame加入前处于等待状态
+func (gm *GameManager) CreateGame(gameID string, opts models.GameOptions, playerID int64) (*models.Game, string) {
+	if gm.shared != nil {
+		if _, err := gm.shared.Acquire(gameID, gm.instanceID, gameLeaseTTL); err != nil {
+			beego.Error("Failed to acquire game lease:", gameID, err)
+		}
+	}
+	defer gm.flushWrites()
 	gm.mutex.Lock()
 	defer gm.mutex.Unlock()
 
-	game := models.NewGame(gameID, gm.width, gm.height, gm.maxWalls)
-	gm.games[gameID] = game
+	if opts.Width == 0 {
+		opts.Width = gm.width
+	}
+	if opts.Height == 0 {
+		opts.Height = gm.height
+	}
+	opts.Width = clampInt(opts.Width, gm.minSize, gm.maxSize)
+	opts.Height = clampInt(opts.Height, gm.minSize, gm.maxSize)
+	if level, ok := models.GetLevelVersion(opts.Level, opts.LevelVersion); ok {
+		opts.Width, opts.Height = level.Width, level.Height
+	}
+	if opts.MaxWalls == 0 {
+		opts.MaxWalls = models.ScaleMaxWalls(gm.maxWalls, opts.Width, opts.Height)
+	}
+	if opts.TickInterval == 0 {
+		opts.TickInterval = gm.speed
+	}
+
+	// 游戏时间按更新次数和间隔推进，与实际调度的误差无关
+	game := models.NewGame(gameID, opts, models.NewTickClock(time.Now()))
+	game.LastActivityAt = time.Now()
+	token := randomHex(32)
+	game.Join(token, playerID)
+	gm.track(game)
+	gm.save(game)
 
-	return game
+	snapshot := game.Clone()
+	return &snapshot, token
 }
 
-// GetGame 获取游戏实例
-func (gm *GameManager) GetGame(gameID string) (*models.Game, bool) {
-	gm.mutex.RLock()
-	defer gm.mutex.RUnlock()
+// JoinGame 加入等待中的多人游戏，返回分配到的蛇ID及控制令牌
+// playerID为加入者的注册玩家ID，游客为0；最后一位玩家加入后游戏立即开始
+func (gm *GameManager) JoinGame(gameID string, playerID int64) (int, string, error) {
+	stored := gm.fetch(gameID)
+	defer gm.flushWrites()
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	game, local, err := gm.lookup(gameID, stored)
+	if err != nil {
+		return 0, "", err
+	}
+	if game.Status != models.GameStatusWaiting {
+		return 0, "", ErrGameFull
+	}
+	if !local {
+		return 0, "", ErrGameRemote
+	}
+
+	token := randomHex(32)
+	snakeID, ok := game.Join(token, playerID)
+	if !ok {
+		return 0, "", ErrGameFull
+	}
+	game.LastActivityAt = time.Now()
+	gm.seated(game)
+
+	return snakeID, token, nil
+}
+
+// seated 有玩家或机器人入座后保存并推送游戏，游戏因此开始时安排第一次更新（调用方需持有锁）
+func (gm *GameManager) seated(game *models.Game) {
+	if game.Active() {
+		gm.reschedule(game)
+	}
+	gm.save(game)
+	gm.publish(game.ID, game.Clone())
+}
+
+// reschedule 游戏开始或继续时，从现在起按更新间隔安排下一次更新（调用方需持有锁）
+func (gm *GameManager) reschedule(game *models.Game) {
+	gm.schedules[game.ID].nextUpdate = time.Now().Add(time.Duration(game.TickInterval) * time.Millisecond)
+}
+
+// Countdown 返回开始和继续前的倒计时（秒）
+func (gm *GameManager) Countdown() int {
+	return gm.countdown
+}
+
+// PauseGame 暂停运行中的游戏，每位玩家的暂停次数有限
+func (gm *GameManager) PauseGame(gameID string, snakeID int) error {
+	stored := gm.fetch(gameID)
+	defer gm.flushWrites()
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	game, local, err := gm.lookup(gameID, stored)
+	if err != nil {
+		return err
+	}
+	if !local {
+		return ErrGameRemote
+	}
+	if game.Status != models.GameStatusRunning {
+		return ErrNotRunning
+	}
+	if snake := game.Snake(snakeID); snake == nil || snake.Pauses >= gm.maxPauses {
+		return ErrPauseLimit
+	}
+
+	game.Pause(snakeID, time.Now())
+	game.LastActivityAt = time.Now()
+	gm.save(game)
+	gm.publish(gameID, game.Clone())
+	return nil
+}
+
+// ResumeGame 继续暂停的游戏，游戏先进入倒计时
+func (gm *GameManager) ResumeGame(gameID string, snakeID int) error {
+	stored := gm.fetch(gameID)
+	defer gm.flushWrites()
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	game, local, err := gm.lookup(gameID, stored)
+	if err != nil {
+		return err
+	}
+	if !local {
+		return ErrGameRemote
+	}
+	if !game.Resume(snakeID, gm.countdown) {
+		return ErrNotPaused
+	}
+
+	game.LastActivityAt = time.Now()
+	gm.reschedule(game)
+	gm.save(game)
+	gm.publish(gameID, game.Clone())
+	return nil
+}
+
+// AddBot 让机器人加入等待中的游戏，返回机器人控制的蛇ID
+func (gm *GameManager) AddBot(gameID, difficulty string) (int, error) {
+	stored := gm.fetch(gameID)
+	defer gm.flushWrites()
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	game, local, err := gm.lookup(gameID, stored)
+	if err != nil {
+		return 0, err
+	}
+	if game.Status != models.GameStatusWaiting {
+		return 0, ErrGameFull
+	}
+	if !local {
+		return 0, ErrGameRemote
+	}
+
+	snakeID, ok := game.AddBot(difficulty)
+	if !ok {
+		return 0, ErrGameFull
+	}
+	gm.seated(game)
+
+	return snakeID, nil
+}
+
+// steerBots 让机器人控制的蛇选择方向，与玩家一样通过ChangeDirection生效（调用方需持有锁）
+func (gm *GameManager) steerBots(game *models.Game) {
+	for _, snake := range game.Snakes {
+		if snake.Bot == "" || !snake.Alive {
+			continue
+		}
+
+		rng := gm.botRNGs[game.ID]
+		if rng == nil {
+			rng = mathrand.New(mathrand.NewSource(models.NewSeed()))
+			gm.botRNGs[game.ID] = rng
+		}
+		if direction, ok := game.BotDirection(snake.ID, rng); ok && direction != snake.Direction {
+			game.ChangeDirection(snake.ID, direction)
+		}
+	}
+}
+
+// CheckControlToken 校验游戏的控制令牌，返回令牌控制的蛇ID
+func (gm *GameManager) CheckControlToken(gameID, token string) (int, error) {
+	stored := gm.fetch(gameID)
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
 
-	game, exists := gm.games[gameID]
-	return game, exists
+	game, _, err := gm.lookup(gameID, stored)
+	if err != nil {
+		return 0, err
+	}
+	snakeID, ok := game.CheckControlToken(token)
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	return snakeID, nil
+}
+
+// GetGame 获取游戏当前状态的副本，读取视为一次玩家活动
+// 副本可以在锁外序列化，不会与更新循环同时读写；游戏不存在时返回ErrGameNotFound，已过期时返回ErrGameExpired
+func (gm *GameManager) GetGame(gameID string) (*models.Game, error) {
+	stored := gm.fetch(gameID)
+	defer gm.flushWrites()
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	game, local, err := gm.lookup(gameID, stored)
+	if err != nil {
+		return nil, err
+	}
+	gm.touch(game, local)
+	snapshot := game.Clone()
+	return &snapshot, nil
 }
 
 // RemoveGame 移除游戏实例
 func (gm *GameManager) RemoveGame(gameID string) {
+	defer gm.flushWrites()
 	gm.mutex.Lock()
 	defer gm.mutex.Unlock()
 
-	delete(gm.games, gameID)
+	gm.forget(gameID)
 }
 
-// UpdateGame 更新游戏方向
-func (gm *GameManager) UpdateGameDirection(gameID string, direction models.Direction) bool {
+// GetReplay 获取游戏录像
+func (gm *GameManager) GetReplay(gameID string) (models.Replay, bool) {
+	stored := gm.fetch(gameID)
 	gm.mutex.Lock()
 	defer gm.mutex.Unlock()
 
-	game, exists := gm.games[gameID]
-	if !exists || game.Status != models.GameStatusRunning {
-		return false
+	game, _, err := gm.lookup(gameID, stored)
+	if err != nil {
+		return models.Replay{}, false
+	}
+	return game.Replay(), true
+}
+
+// Subscribe 订阅游戏状态推送，每次游戏更新后都会收到最新状态
+// 只能订阅由本实例负责更新的游戏；返回的取消函数用于退订，游戏被移除时通道会被关闭
+func (gm *GameManager) Subscribe(gameID string) (<-chan models.Game, func(), bool) {
+	stored := gm.fetch(gameID)
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	if _, local, _ := gm.lookup(gameID, stored); !local {
+		return nil, nil, false
+	}
+
+	ch := make(chan models.Game, 1)
+	if gm.subscribers[gameID] == nil {
+		gm.subscribers[gameID] = make(map[chan models.Game]struct{})
+	}
+	gm.subscribers[gameID][ch] = struct{}{}
+
+	unsubscribe := func() {
+		gm.mutex.Lock()
+		defer gm.mutex.Unlock()
+
+		if subs, ok := gm.subscribers[gameID]; ok {
+			if _, ok := subs[ch]; ok {
+				delete(subs, ch)
+				close(ch)
+			}
+			if len(subs) == 0 {
+				delete(gm.subscribers, gameID)
+			}
+		}
 	}
+	return ch, unsubscribe, true
+}
 
-	game.ChangeDirection(direction)
+// publish 向订阅者推送游戏状态（调用方需持有锁）
+// 订阅者处理不及时时丢弃旧状态，只保留最新的一帧
+func (gm *GameManager) publish(gameID string, game models.Game) {
+	for ch := range gm.subscribers[gameID] {
+		select {
+		case ch <- game:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- game:
+			default:
+			}
+		}
+	}
+}
+
+// closeSubscribers 关闭游戏的所有订阅通道（调用方需持有锁）
+func (gm *GameManager) closeSubscribers(gameID string) {
+	for ch := range gm.subscribers[gameID] {
+		close(ch)
+	}
+	delete(gm.subscribers, gameID)
+}
+
+// UpdateGameDirection 将转向加入游戏中指定蛇的转向队列，之后的每次更新最多生效一个
+func (gm *GameManager) UpdateGameDirection(gameID string, snakeID int, direction models.Direction) bool {
+	local, ok := gm.changeDirection(gameID, snakeID, direction)
+	if !ok || local {
+		return ok
+	}
+
+	// 游戏由其他实例负责时在锁外转发输入
+	if err := gm.shared.PushDirection(gameID, snakeID, direction); err != nil {
+		beego.Error("Failed to forward direction:", gameID, err)
+		return false
+	}
 	return true
 }
 
-// startUpdateLoop 启动游戏更新循环
-func (gm *GameManager) startUpdateLoop() {
-	ticker := time.NewTicker(time.Duration(gm.speed) * time.Millisecond)
+// changeDirection 记录玩家活动，游戏由本实例负责时直接应用转向
+// 返回游戏是否由本实例负责，以及游戏是否在进行中
+func (gm *GameManager) changeDirection(gameID string, snakeID int, direction models.Direction) (bool, bool) {
+	stored := gm.fetch(gameID)
+	defer gm.flushWrites()
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	game, local, err := gm.lookup(gameID, stored)
+	if err != nil || !game.Active() {
+		return local, false
+	}
+	gm.touch(game, local)
+	if local {
+		game.ChangeDirection(snakeID, direction)
+	}
+	return local, true
+}
+
+// ClaimRecord 标记蛇的成绩已提交，并返回服务器端的游戏和蛇的快照
+// 只有已结束且未提交过成绩的蛇才能成功标记；score不为nil时必须与服务器端的得分一致，否则不做标记
+func (gm *GameManager) ClaimRecord(gameID string, snakeID int, score *int) (models.Game, models.Snake, error) {
+	stored := gm.fetch(gameID)
+	defer gm.flushWrites()
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	game, local, err := gm.lookup(gameID, stored)
+	if err != nil {
+		return models.Game{}, models.Snake{}, err
+	}
+	// 只读快照上的标记不会被保存，必须由负责该游戏的实例处理
+	if !local {
+		return models.Game{}, models.Snake{}, ErrGameRemote
+	}
+	if game.Status != models.GameStatusEnded {
+		return models.Game{}, models.Snake{}, ErrGameNotEnded
+	}
+	// 指定种子的游戏可以反复演练同一局，只用于复现和调试
+	if game.CustomSeed {
+		return models.Game{}, models.Snake{}, ErrCustomSeed
+	}
+	snake := game.Snake(snakeID)
+	if snake == nil {
+		return models.Game{}, models.Snake{}, ErrInvalidToken
+	}
+	if snake.Recorded {
+		return models.Game{}, models.Snake{}, ErrRecordExists
+	}
+	if score != nil && *score != snake.Score {
+		return models.Game{}, models.Snake{}, ErrScoreMismatch
+	}
+
+	snake.Recorded = true
+	gm.save(game)
+	return game.Clone(), *snake, nil
+}
+
+// ReleaseRecord 撤销成绩提交标记（用于保存记录失败时允许重试）
+// 与ClaimRecord一样只能由负责该游戏的实例处理，否则返回ErrGameRemote
+func (gm *GameManager) ReleaseRecord(gameID string, snakeID int) error {
+	stored := gm.fetch(gameID)
+	defer gm.flushWrites()
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	game, local, err := gm.lookup(gameID, stored)
+	if err != nil {
+		return err
+	}
+	if !local {
+		return ErrGameRemote
+	}
+	if snake := game.Snake(snakeID); snake != nil {
+		snake.Recorded = false
+		gm.save(game)
+	}
+	return nil
+}
+
+// Start 启动游戏更新循环，重复调用无效
+func (gm *GameManager) Start() {
+	gm.lifecycleMutex.Lock()
+	defer gm.lifecycleMutex.Unlock()
+
+	if gm.stopCh != nil {
+		return
+	}
+	gm.stopCh = make(chan struct{})
+	gm.doneCh = make(chan struct{})
+	go gm.startUpdateLoop(gm.stopCh, gm.doneCh)
+}
+
+// Stop 停止游戏更新循环并等待其退出，同时断开所有状态推送连接
+// 停止后游戏时间不再推进，可以再次调用Start恢复
+func (gm *GameManager) Stop() {
+	gm.lifecycleMutex.Lock()
+	defer gm.lifecycleMutex.Unlock()
+
+	if gm.stopCh == nil {
+		return
+	}
+	close(gm.stopCh)
+	<-gm.doneCh
+	gm.stopCh, gm.doneCh = nil, nil
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+	for gameID := range gm.subscribers {
+		gm.closeSubscribers(gameID)
+	}
+}
+
+// Flush 保存本实例负责的所有游戏并释放租约，用于服务关闭前
+// 使用Redis存储时其他实例可以立即接管这些游戏；使用内存存储时游戏会随进程退出而丢失
+func (gm *GameManager) Flush() {
+	defer gm.flushWrites()
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	running := 0
+	for gameID, game := range gm.games {
+		if game.Active() || game.Status == models.GameStatusPaused {
+			running++
+		}
+		gm.save(game)
+		if gm.shared != nil {
+			gm.pendingWrite(gameID).release = true
+		}
+		delete(gm.games, gameID)
+		delete(gm.schedules, gameID)
+	}
+
+	if gm.shared != nil {
+		beego.Info("Persisted", running, "running games for other instances to resume")
+	} else if running > 0 {
+		beego.Warn("Memory game store in use,", running, "running games will be lost; set game.store = redis to keep games across restarts")
+	}
+}
+
+// startUpdateLoop 游戏更新循环，每局游戏按各自的更新间隔更新
+func (gm *GameManager) startUpdateLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(schedulerInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		gm.updateAllGames()
+	for {
+		select {
+		case now := <-ticker.C:
+			gm.updateAllGames(now)
+		case <-stop:
+			return
+		}
 	}
 }
 
-// updateAllGames 更新所有游戏
-func (gm *GameManager) updateAllGames() {
+// updateAllGames 更新所有到期的游戏
+// 使用共享存储时，续期租约、读取转发的方向和保存状态都在锁外批量进行，不阻塞其他请求
+func (gm *GameManager) updateAllGames(now time.Time) {
+	renew, due := gm.collectDueGames(now)
+
+	var leases map[string]bool
+	var activity map[string]time.Time
+	var inputs map[string][]DirectionInput
+	if gm.shared != nil {
+		leases = gm.renewLeases(renew)
+		// 续期租约时一并读取其他实例上的玩家活动
+		var err error
+		if activity, err = gm.shared.LastActivity(renew); err != nil {
+			beego.Error("Failed to read game activity:", err)
+		}
+		// 读取其他实例转发来的方向输入，更新前应用
+		if inputs, err = gm.shared.PopDirections(due); err != nil {
+			beego.Error("Failed to read forwarded directions:", err)
+		}
+	}
+
+	gm.updateDueGames(now, leases, activity, due, inputs)
+	gm.flushWrites()
+}
+
+// collectDueGames 移除过期的游戏、自动继续暂停超时的游戏，返回需要续期租约和到了更新时间的游戏
+func (gm *GameManager) collectDueGames(now time.Time) ([]string, []string) {
 	gm.mutex.Lock()
 	defer gm.mutex.Unlock()
 
-	// 清理超过一定时间的游戏记录
-	now := time.Now()
+	var renew, due []string
 	for gameID, game := range gm.games {
-		// 更新游戏状态
+		schedule := gm.schedules[gameID]
+
+		// 定期续期租约，租约被其他实例接管时不再更新该游戏
+		if gm.shared != nil && now.Sub(schedule.leaseRenewedAt) >= gameLeaseRenewal {
+			renew = append(renew, gameID)
+		}
+
+		// 有连接在接收推送时视为玩家仍在活动
+		if len(gm.subscribers[gameID]) > 0 {
+			game.LastActivityAt = now
+		}
+
+		// 按最后活动时间移除长时间无活动的游戏
+		if reason := gm.expireReason(game, now); reason != "" {
+			gm.expire(gameID, reason)
+			continue
+		}
+
+		// 暂停超过时长上限的游戏自动继续
+		if game.Status == models.GameStatusPaused && gm.maxPause > 0 && now.Sub(game.PausedAt) > gm.maxPause {
+			game.Resume(models.NoSnake, gm.countdown)
+			gm.reschedule(game)
+			gm.save(game)
+			gm.publish(gameID, game.Clone())
+			continue
+		}
+
+		if game.Active() && !now.Before(schedule.nextUpdate) {
+			due = append(due, gameID)
+		}
+	}
+	return renew, due
+}
+
+// renewLeases 续期游戏的租约，返回各游戏是否仍由本实例持有，续期失败时视为仍然持有
+func (gm *GameManager) renewLeases(gameIDs []string) map[string]bool {
+	leases := make(map[string]bool, len(gameIDs))
+	for _, gameID := range gameIDs {
+		owned, err := gm.shared.Acquire(gameID, gm.instanceID, gameLeaseTTL)
+		if err != nil {
+			beego.Error("Failed to renew game lease:", gameID, err)
+			owned = true
+		}
+		leases[gameID] = owned
+	}
+	return leases
+}
+
+// updateDueGames 处理租约续期的结果和其他实例上的玩家活动，更新到了更新时间的游戏并推送
+func (gm *GameManager) updateDueGames(now time.Time, leases map[string]bool, activity map[string]time.Time, due []string, inputs map[string][]DirectionInput) {
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	for gameID, owned := range leases {
+		schedule, exists := gm.schedules[gameID]
+		if !exists {
+			continue
+		}
+		if !owned {
+			// 游戏已由其他实例接管，不能再写入本实例的状态
+			gm.untrack(gameID)
+			delete(gm.writes, gameID)
+			continue
+		}
+		schedule.leaseRenewedAt = now
+
+		if game := gm.games[gameID]; activity[gameID].After(game.LastActivityAt) {
+			game.LastActivityAt = activity[gameID]
+			if !game.Active() {
+				gm.save(game)
+			}
+		}
+	}
+
+	for _, gameID := range due {
+		// 读取转发输入期间游戏可能已被移除或暂停
+		game, exists := gm.games[gameID]
+		if !exists || !game.Active() {
+			continue
+		}
+		schedule := gm.schedules[gameID]
+
+		// 应用其他实例转发来的方向输入，转发输入也是玩家活动
+		if len(inputs[gameID]) > 0 {
+			game.LastActivityAt = now
+		}
+		for _, input := range inputs[gameID] {
+			game.ChangeDirection(input.SnakeID, input.Direction)
+		}
+
+		// 机器人根据最新状态选择方向
+		gm.steerBots(game)
+
+		// 更新游戏状态，保存并推送
 		game.Update()
+		if game.Status == models.GameStatusEnded {
+			// 已结束游戏的保留时长从结束时开始计算
+			game.LastActivityAt = now
+		}
+		gm.save(game)
+		gm.publish(gameID, game.Clone())
 
-		// 如果超过10分钟没有活动，移除游戏
-		if now.Sub(game.CreatedAt).Minutes() > 10 {
-			delete(gm.games, gameID)
+		// 按游戏当前的更新间隔安排下一次更新，落后太多时不再追赶
+		interval := time.Duration(game.TickInterval) * time.Millisecond
+		schedule.nextUpdate = schedule.nextUpdate.Add(interval)
+		if schedule.nextUpdate.Before(now) {
+			schedule.nextUpdate = now.Add(interval)
 		}
 	}
 }
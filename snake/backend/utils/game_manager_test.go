@@ -0,0 +1,479 @@
+package utils
+
+import (
+	"blockcade/models"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestManager 创建使用内存存储、不启动更新循环的游戏管理器
+func newTestManager() *GameManager {
+	return &GameManager{
+		games:       make(map[string]*models.Game),
+		schedules:   make(map[string]*gameSchedule),
+		store:       NewMemoryGameStore(),
+		instanceID:  newInstanceID(),
+		subscribers: make(map[string]map[chan models.Game]struct{}),
+		botRNGs:     make(map[string]*rand.Rand),
+		writes:      make(map[string]*storeWrite),
+		width:       15,
+		height:      15,
+		minSize:     models.MinBoardSize,
+		maxSize:     models.MaxBoardSize,
+		maxWalls:    6,
+		speed:       200,
+		countdown:   3,
+		maxPauses:   3,
+		runningTTL:  5 * time.Minute,
+		endedTTL:    10 * time.Minute,
+	}
+}
+
+// endedGame 创建一局已结束的单人游戏，返回游戏ID和控制令牌
+func endedGame(gm *GameManager, score int) (string, string) {
+	gameID := NewGameID()
+	_, token := gm.CreateGame(gameID, models.GameOptions{}, 0)
+	game := gm.games[gameID]
+	game.Status = models.GameStatusEnded
+	game.Snake(0).Alive = false
+	game.Snake(0).Score = score
+	return gameID, token
+}
+
+func TestClaimRecord(t *testing.T) {
+	score := func(v int) *int { return &v }
+
+	t.Run("游戏未结束", func(t *testing.T) {
+		gm := newTestManager()
+		gameID := NewGameID()
+		gm.CreateGame(gameID, models.GameOptions{}, 0)
+		if _, _, err := gm.ClaimRecord(gameID, 0, nil); err != ErrGameNotEnded {
+			t.Fatalf("err = %v, want ErrGameNotEnded", err)
+		}
+	})
+
+	t.Run("游戏不存在", func(t *testing.T) {
+		gm := newTestManager()
+		if _, _, err := gm.ClaimRecord(NewGameID(), 0, nil); err != ErrGameNotFound {
+			t.Fatalf("err = %v, want ErrGameNotFound", err)
+		}
+	})
+
+	t.Run("只能提交一次", func(t *testing.T) {
+		gm := newTestManager()
+		gameID, _ := endedGame(gm, 7)
+		_, snake, err := gm.ClaimRecord(gameID, 0, score(7))
+		if err != nil {
+			t.Fatalf("第一次提交: %v", err)
+		}
+		if snake.Score != 7 {
+			t.Errorf("Score = %d, want 7", snake.Score)
+		}
+		if _, _, err := gm.ClaimRecord(gameID, 0, score(7)); err != ErrRecordExists {
+			t.Fatalf("第二次提交 err = %v, want ErrRecordExists", err)
+		}
+		// 写入失败释放后可以重新提交
+		gm.ReleaseRecord(gameID, 0)
+		if _, _, err := gm.ClaimRecord(gameID, 0, score(7)); err != nil {
+			t.Fatalf("释放后提交: %v", err)
+		}
+	})
+
+	t.Run("控制令牌无效", func(t *testing.T) {
+		gm := newTestManager()
+		gameID, token := endedGame(gm, 3)
+		if _, err := gm.CheckControlToken(gameID, token+"0"); err != ErrInvalidToken {
+			t.Fatalf("err = %v, want ErrInvalidToken", err)
+		}
+		if _, err := gm.CheckControlToken(gameID, ""); err != ErrInvalidToken {
+			t.Fatalf("空令牌 err = %v, want ErrInvalidToken", err)
+		}
+		snakeID, err := gm.CheckControlToken(gameID, token)
+		if err != nil || snakeID != 0 {
+			t.Fatalf("CheckControlToken = %d, %v, want 0, nil", snakeID, err)
+		}
+	})
+
+	t.Run("蛇不存在", func(t *testing.T) {
+		gm := newTestManager()
+		gameID, _ := endedGame(gm, 3)
+		if _, _, err := gm.ClaimRecord(gameID, 1, nil); err != ErrInvalidToken {
+			t.Fatalf("err = %v, want ErrInvalidToken", err)
+		}
+	})
+
+	t.Run("指定种子的游戏", func(t *testing.T) {
+		gm := newTestManager()
+		gameID, _ := endedGame(gm, 3)
+		gm.games[gameID].CustomSeed = true
+		if _, _, err := gm.ClaimRecord(gameID, 0, nil); err != ErrCustomSeed {
+			t.Fatalf("err = %v, want ErrCustomSeed", err)
+		}
+	})
+
+	t.Run("得分不一致时不标记", func(t *testing.T) {
+		gm := newTestManager()
+		gameID, _ := endedGame(gm, 5)
+		if _, _, err := gm.ClaimRecord(gameID, 0, score(50)); err != ErrScoreMismatch {
+			t.Fatalf("err = %v, want ErrScoreMismatch", err)
+		}
+		if gm.games[gameID].Snake(0).Recorded {
+			t.Fatal("得分不一致后成绩仍被标记为已提交")
+		}
+		if _, _, err := gm.ClaimRecord(gameID, 0, score(5)); err != nil {
+			t.Fatalf("得分一致时提交: %v", err)
+		}
+	})
+}
+
+// fakeSharedStore 测试用的共享存储，写入时可以阻塞以模拟缓慢的网络往返
+type fakeSharedStore struct {
+	mutex   sync.Mutex
+	states  map[string][]byte
+	owners  map[string]string
+	inputs  map[string][]DirectionInput
+	active  map[string]time.Time
+	writing chan struct{} // 每次开始写入时收到通知，为nil时不通知
+	blocked chan struct{} // 非nil时写入阻塞到通道关闭
+}
+
+func newFakeSharedStore() *fakeSharedStore {
+	return &fakeSharedStore{
+		states: make(map[string][]byte),
+		owners: make(map[string]string),
+		inputs: make(map[string][]DirectionInput),
+		active: make(map[string]time.Time),
+	}
+}
+
+func (s *fakeSharedStore) Load(gameID string) (*models.Game, error) {
+	s.mutex.Lock()
+	data, ok := s.states[gameID]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	return models.UnmarshalGameState(data)
+}
+
+func (s *fakeSharedStore) Save(game *models.Game) error {
+	data, err := game.MarshalState()
+	if err != nil {
+		return err
+	}
+	return s.SaveStates(map[string][]byte{game.ID: data})
+}
+
+// write 模拟一次写入的网络往返
+func (s *fakeSharedStore) write() {
+	if s.writing != nil {
+		s.writing <- struct{}{}
+	}
+	if s.blocked != nil {
+		<-s.blocked
+	}
+}
+
+func (s *fakeSharedStore) SaveStates(states map[string][]byte) error {
+	s.write()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for gameID, data := range states {
+		s.states[gameID] = data
+	}
+	return nil
+}
+
+func (s *fakeSharedStore) Delete(gameID string) error {
+	s.write()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.states, gameID)
+	return nil
+}
+
+func (s *fakeSharedStore) Expire(gameID string, retention time.Duration) error {
+	return s.Delete(gameID)
+}
+
+func (s *fakeSharedStore) IDs() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var ids []string
+	for gameID := range s.states {
+		ids = append(ids, gameID)
+	}
+	return ids, nil
+}
+
+func (s *fakeSharedStore) Acquire(gameID, owner string, ttl time.Duration) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if current, ok := s.owners[gameID]; ok && current != owner {
+		return false, nil
+	}
+	s.owners[gameID] = owner
+	return true, nil
+}
+
+func (s *fakeSharedStore) Release(gameID, owner string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.owners[gameID] == owner {
+		delete(s.owners, gameID)
+	}
+	return nil
+}
+
+func (s *fakeSharedStore) PushDirection(gameID string, snakeID int, direction models.Direction) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inputs[gameID] = append(s.inputs[gameID], DirectionInput{SnakeID: snakeID, Direction: direction})
+	return nil
+}
+
+func (s *fakeSharedStore) PopDirections(gameIDs []string) (map[string][]DirectionInput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	inputs := make(map[string][]DirectionInput)
+	for _, gameID := range gameIDs {
+		if len(s.inputs[gameID]) > 0 {
+			inputs[gameID] = s.inputs[gameID]
+			delete(s.inputs, gameID)
+		}
+	}
+	return inputs, nil
+}
+
+func (s *fakeSharedStore) Touch(gameID string, at time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.active[gameID] = at
+	return nil
+}
+
+func (s *fakeSharedStore) LastActivity(gameIDs []string) (map[string]time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	activity := make(map[string]time.Time)
+	for _, gameID := range gameIDs {
+		if at, ok := s.active[gameID]; ok {
+			activity[gameID] = at
+		}
+	}
+	return activity, nil
+}
+
+// newSharedTestManager 创建使用共享存储的游戏管理器
+func newSharedTestManager(store *fakeSharedStore) *GameManager {
+	gm := newTestManager()
+	gm.store, gm.shared = store, store
+	return gm
+}
+
+func TestSharedStoreWritesOutsideLock(t *testing.T) {
+	store := newFakeSharedStore()
+	gm := newSharedTestManager(store)
+	gameID := NewGameID()
+	_, token := gm.CreateGame(gameID, models.GameOptions{}, 0)
+	if _, err := store.Load(gameID); err != nil {
+		t.Fatalf("创建后存储中没有游戏: %v", err)
+	}
+
+	// 写入存储卡住时，其他请求仍可以读取游戏
+	store.writing, store.blocked = make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gm.RemoveGame(gameID)
+	}()
+	<-store.writing
+
+	checked := make(chan error)
+	go func() {
+		_, err := gm.CheckControlToken(gameID, token)
+		checked <- err
+	}()
+	select {
+	case err := <-checked:
+		// 移除尚未写入存储，读取也不能再拿到游戏
+		if err != ErrGameNotFound {
+			t.Errorf("err = %v, want ErrGameNotFound", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("写入存储时持有游戏锁")
+	}
+
+	close(store.blocked)
+	<-done
+	if _, err := store.Load(gameID); err != ErrGameNotFound {
+		t.Errorf("移除后 Load err = %v, want ErrGameNotFound", err)
+	}
+	if owner := store.owners[gameID]; owner != "" {
+		t.Errorf("移除后租约仍由 %q 持有", owner)
+	}
+}
+
+func TestSharedStoreRemoteGame(t *testing.T) {
+	store := newFakeSharedStore()
+	other := newSharedTestManager(store)
+	gameID, _ := endedGame(other, 4)
+	other.mutex.Lock()
+	other.save(other.games[gameID])
+	other.mutex.Unlock()
+	other.flushWrites()
+
+	gm := newSharedTestManager(store)
+	game, err := gm.GetGame(gameID)
+	if err != nil {
+		t.Fatalf("GetGame: %v", err)
+	}
+	if game.Snake(0).Score != 4 {
+		t.Errorf("Score = %d, want 4", game.Snake(0).Score)
+	}
+	if _, ok := gm.games[gameID]; ok {
+		t.Error("接管了其他实例持有租约的游戏")
+	}
+	if _, _, err := gm.ClaimRecord(gameID, 0, nil); err != ErrGameRemote {
+		t.Errorf("ClaimRecord err = %v, want ErrGameRemote", err)
+	}
+	if err := gm.ReleaseRecord(gameID, 0); err != ErrGameRemote {
+		t.Errorf("ReleaseRecord err = %v, want ErrGameRemote", err)
+	}
+
+	// 租约释放后由读取的实例接管
+	other.Flush()
+	if _, _, err := gm.ClaimRecord(gameID, 0, nil); err != nil {
+		t.Fatalf("接管后 ClaimRecord: %v", err)
+	}
+	if _, ok := gm.games[gameID]; !ok {
+		t.Error("租约释放后没有接管游戏")
+	}
+}
+
+func TestSharedStoreRemoteActivity(t *testing.T) {
+	store := newFakeSharedStore()
+	owner := newSharedTestManager(store)
+	gameID := NewGameID()
+	owner.CreateGame(gameID, models.GameOptions{}, 0)
+	game := owner.games[gameID]
+	idle := time.Now().Add(-time.Minute)
+
+	// 其他实例上的读取通过共享存储推迟过期时间
+	remote := newSharedTestManager(store)
+	game.LastActivityAt = idle
+	if _, err := remote.GetGame(gameID); err != nil {
+		t.Fatalf("GetGame: %v", err)
+	}
+	owner.schedules[gameID].leaseRenewedAt = idle
+	owner.updateAllGames(time.Now())
+	if !game.LastActivityAt.After(idle) {
+		t.Error("其他实例上的读取没有推迟过期时间")
+	}
+
+	// 转发来的方向输入也是玩家活动
+	game.LastActivityAt = idle
+	if !remote.UpdateGameDirection(gameID, 0, models.Down) {
+		t.Fatal("UpdateGameDirection 失败")
+	}
+	store.active = make(map[string]time.Time)
+	now := time.Now().Add(time.Second)
+	owner.updateAllGames(now)
+	if !game.LastActivityAt.Equal(now) {
+		t.Errorf("LastActivityAt = %v, want %v", game.LastActivityAt, now)
+	}
+}
+
+func TestExpireReason(t *testing.T) {
+	gm := newTestManager()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		status string
+		idle   time.Duration
+		want   string
+	}{
+		{"运行中：未超时", models.GameStatusRunning, gm.runningTTL, ""},
+		{"运行中：超时", models.GameStatusRunning, gm.runningTTL + time.Second, expireReasonIdle},
+		{"暂停：超时", models.GameStatusPaused, gm.runningTTL + time.Second, expireReasonIdle},
+		{"等待中：超时", models.GameStatusWaiting, gm.runningTTL + time.Second, expireReasonIdle},
+		{"已结束：超过运行中的时长", models.GameStatusEnded, gm.runningTTL + time.Second, ""},
+		{"已结束：未超时", models.GameStatusEnded, gm.endedTTL, ""},
+		{"已结束：超时", models.GameStatusEnded, gm.endedTTL + time.Second, expireReasonEnded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := &models.Game{Status: tt.status, LastActivityAt: now.Add(-tt.idle)}
+			if got := gm.expireReason(game, now); got != tt.want {
+				t.Errorf("expireReason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpireIdleGame(t *testing.T) {
+	gm := newTestManager()
+	gameID, _ := endedGame(gm, 0)
+	ended := gm.games[gameID].LastActivityAt
+
+	gm.updateAllGames(ended.Add(gm.endedTTL))
+	if _, err := gm.GetGame(gameID); err != nil {
+		t.Fatalf("保留时长内 GetGame: %v", err)
+	}
+	gm.updateAllGames(time.Now().Add(gm.endedTTL + time.Second))
+	if _, err := gm.GetGame(gameID); err != ErrGameExpired {
+		t.Fatalf("err = %v, want ErrGameExpired", err)
+	}
+}
+
+func TestPauseGameLimits(t *testing.T) {
+	gm := newTestManager()
+	gm.maxPause, gm.countdown = time.Minute, 0
+	gameID := NewGameID()
+	gm.CreateGame(gameID, models.GameOptions{Players: 2}, 0)
+	if _, _, err := gm.JoinGame(gameID, 0); err != nil {
+		t.Fatalf("JoinGame: %v", err)
+	}
+	if err := gm.PauseGame(gameID, 0); err != nil {
+		t.Fatalf("PauseGame: %v", err)
+	}
+	if err := gm.PauseGame(gameID, 1); err != ErrNotRunning {
+		t.Errorf("已暂停时 PauseGame err = %v, want ErrNotRunning", err)
+	}
+	if err := gm.ResumeGame(gameID, 1); err != nil {
+		t.Fatalf("ResumeGame: %v", err)
+	}
+	if err := gm.ResumeGame(gameID, 1); err != ErrNotPaused {
+		t.Errorf("未暂停时 ResumeGame err = %v, want ErrNotPaused", err)
+	}
+
+	// 每位玩家的暂停次数分别计算
+	for i := 1; i < gm.maxPauses; i++ {
+		if err := gm.PauseGame(gameID, 0); err != nil {
+			t.Fatalf("第%d次暂停: %v", i+1, err)
+		}
+		if err := gm.ResumeGame(gameID, 0); err != nil {
+			t.Fatalf("第%d次继续: %v", i+1, err)
+		}
+	}
+	if err := gm.PauseGame(gameID, 0); err != ErrPauseLimit {
+		t.Fatalf("超过次数 err = %v, want ErrPauseLimit", err)
+	}
+	if err := gm.PauseGame(gameID, 1); err != nil {
+		t.Fatalf("另一位玩家暂停: %v", err)
+	}
+
+	// 超过单次暂停的最长时间后自动继续
+	game := gm.games[gameID]
+	gm.updateAllGames(game.PausedAt.Add(gm.maxPause))
+	if game.Status != models.GameStatusPaused {
+		t.Fatalf("未超时 Status = %q", game.Status)
+	}
+	gm.updateAllGames(game.PausedAt.Add(gm.maxPause + time.Second))
+	if game.Status != models.GameStatusRunning || game.PausedBy != models.NoSnake {
+		t.Errorf("超时后 Status = %q, PausedBy = %d, want 自动继续", game.Status, game.PausedBy)
+	}
+}
@@ -0,0 +1,328 @@
+package utils
+
+import (
+	"blockcade/models"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// GameStore 游戏状态存储
+type GameStore interface {
+	// Load 读取游戏，不存在时返回ErrGameNotFound
+	Load(gameID string) (*models.Game, error)
+	// Save 保存游戏
+	Save(game *models.Game) error
+	// Delete 删除游戏
+	Delete(gameID string) error
+	// Expire 删除过期的游戏，并在retention内让Load返回ErrGameExpired
+	Expire(gameID string, retention time.Duration) error
+	// IDs 返回所有已保存游戏的ID
+	IDs() ([]string, error)
+}
+
+// SharedGameStore 可被多个服务实例共享的游戏存储
+// 每局游戏同一时间只由持有租约的实例负责更新，其他实例收到的方向输入通过存储转发
+type SharedGameStore interface {
+	GameStore
+	// Acquire 获取或续期游戏的租约，返回是否由owner持有
+	Acquire(gameID, owner string, ttl time.Duration) (bool, error)
+	// Release 释放owner持有的租约
+	Release(gameID, owner string) error
+	// PushDirection 转发方向输入给持有租约的实例
+	PushDirection(gameID string, snakeID int, direction models.Direction) error
+	// PopDirections 取出多局游戏所有待处理的方向输入，按游戏ID返回
+	PopDirections(gameIDs []string) (map[string][]DirectionInput, error)
+	// SaveStates 一次保存多局游戏已序列化的完整状态，按游戏ID传入
+	SaveStates(states map[string][]byte) error
+	// Touch 记录其他实例上的玩家活动时间，由持有租约的实例读取
+	Touch(gameID string, at time.Time) error
+	// LastActivity 读取多局游戏在其他实例上的最后活动时间，没有记录的游戏不返回
+	LastActivity(gameIDs []string) (map[string]time.Time, error)
+}
+
+// DirectionInput 转发给其他实例的方向输入
+type DirectionInput struct {
+	SnakeID   int
+	Direction models.Direction
+}
+
+// MemoryGameStore 基于内存的游戏存储，服务重启后数据丢失
+type MemoryGameStore struct {
+	games   map[string]*models.Game
+	expired map[string]time.Time // 已过期游戏的ID及记录保留截止时间
+	mutex   sync.RWMutex
+}
+
+// NewMemoryGameStore 创建内存游戏存储
+func NewMemoryGameStore() *MemoryGameStore {
+	return &MemoryGameStore{
+		games:   make(map[string]*models.Game),
+		expired: make(map[string]time.Time),
+	}
+}
+
+// Load 读取游戏
+func (s *MemoryGameStore) Load(gameID string) (*models.Game, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	game, exists := s.games[gameID]
+	if !exists {
+		if until, ok := s.expired[gameID]; ok && time.Now().Before(until) {
+			return nil, ErrGameExpired
+		}
+		return nil, ErrGameNotFound
+	}
+	return game, nil
+}
+
+// Save 保存游戏
+func (s *MemoryGameStore) Save(game *models.Game) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.games[game.ID] = game
+	return nil
+}
+
+// Delete 删除游戏
+func (s *MemoryGameStore) Delete(gameID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.games, gameID)
+	return nil
+}
+
+// Expire 删除过期的游戏并保留过期记录
+func (s *MemoryGameStore) Expire(gameID string, retention time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	delete(s.games, gameID)
+	s.expired[gameID] = now.Add(retention)
+
+	// 顺便清理已超过保留时间的过期记录
+	for id, until := range s.expired {
+		if now.After(until) {
+			delete(s.expired, id)
+		}
+	}
+	return nil
+}
+
+// IDs 返回所有游戏ID
+func (s *MemoryGameStore) IDs() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ids := make([]string, 0, len(s.games))
+	for id := range s.games {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Redis中游戏相关的键
+const (
+	redisGameKeyPrefix = "snake:game:"
+	redisGameIDsKey    = "snake:games"
+)
+
+// releaseScript 只有租约持有者才能释放租约
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// acquireScript 租约空闲或已由owner持有时获取并续期
+var acquireScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == false or owner == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// RedisGameStore 基于Redis的游戏存储，游戏在服务重启后保留，并可由多个实例共享
+type RedisGameStore struct {
+	client *redis.Client
+	ttl    time.Duration // 游戏状态的过期时间，防止所有实例都退出后数据残留
+}
+
+// NewRedisGameStore 创建Redis游戏存储
+func NewRedisGameStore(client *redis.Client, ttl time.Duration) *RedisGameStore {
+	return &RedisGameStore{client: client, ttl: ttl}
+}
+
+func (s *RedisGameStore) gameKey(gameID string) string {
+	return redisGameKeyPrefix + gameID
+}
+
+func (s *RedisGameStore) ownerKey(gameID string) string {
+	return redisGameKeyPrefix + gameID + ":owner"
+}
+
+func (s *RedisGameStore) inputsKey(gameID string) string {
+	return redisGameKeyPrefix + gameID + ":inputs"
+}
+
+func (s *RedisGameStore) activityKey(gameID string) string {
+	return redisGameKeyPrefix + gameID + ":activity"
+}
+
+func (s *RedisGameStore) expiredKey(gameID string) string {
+	return redisGameKeyPrefix + gameID + ":expired"
+}
+
+// Load 读取游戏
+func (s *RedisGameStore) Load(gameID string) (*models.Game, error) {
+	data, err := s.client.Get(Ctx, s.gameKey(gameID)).Bytes()
+	if err == redis.Nil {
+		// 游戏不存在或已过期，顺便清理ID集合
+		s.client.SRem(Ctx, redisGameIDsKey, gameID)
+		if n, _ := s.client.Exists(Ctx, s.expiredKey(gameID)).Result(); n > 0 {
+			return nil, ErrGameExpired
+		}
+		return nil, ErrGameNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return models.UnmarshalGameState(data)
+}
+
+// Save 保存游戏
+func (s *RedisGameStore) Save(game *models.Game) error {
+	data, err := game.MarshalState()
+	if err != nil {
+		return err
+	}
+	return s.SaveStates(map[string][]byte{game.ID: data})
+}
+
+// SaveStates 在一次往返中保存多局游戏的状态
+func (s *RedisGameStore) SaveStates(states map[string][]byte) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	pipe := s.client.TxPipeline()
+	for gameID, data := range states {
+		pipe.Set(Ctx, s.gameKey(gameID), data, s.ttl)
+		pipe.SAdd(Ctx, redisGameIDsKey, gameID)
+	}
+	_, err := pipe.Exec(Ctx)
+	return err
+}
+
+// Delete 删除游戏
+func (s *RedisGameStore) Delete(gameID string) error {
+	pipe := s.client.TxPipeline()
+	pipe.Del(Ctx, s.gameKey(gameID), s.inputsKey(gameID), s.activityKey(gameID))
+	pipe.SRem(Ctx, redisGameIDsKey, gameID)
+	_, err := pipe.Exec(Ctx)
+	return err
+}
+
+// Expire 删除过期的游戏并保留过期记录
+func (s *RedisGameStore) Expire(gameID string, retention time.Duration) error {
+	pipe := s.client.TxPipeline()
+	pipe.Del(Ctx, s.gameKey(gameID), s.inputsKey(gameID), s.activityKey(gameID))
+	pipe.SRem(Ctx, redisGameIDsKey, gameID)
+	pipe.Set(Ctx, s.expiredKey(gameID), 1, retention)
+	_, err := pipe.Exec(Ctx)
+	return err
+}
+
+// IDs 返回所有游戏ID
+func (s *RedisGameStore) IDs() ([]string, error) {
+	return s.client.SMembers(Ctx, redisGameIDsKey).Result()
+}
+
+// Acquire 获取或续期游戏的租约
+func (s *RedisGameStore) Acquire(gameID, owner string, ttl time.Duration) (bool, error) {
+	acquired, err := acquireScript.Run(Ctx, s.client, []string{s.ownerKey(gameID)}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return acquired == 1, nil
+}
+
+// Release 释放租约
+func (s *RedisGameStore) Release(gameID, owner string) error {
+	return releaseScript.Run(Ctx, s.client, []string{s.ownerKey(gameID)}, owner).Err()
+}
+
+// PushDirection 转发方向输入，以“蛇ID:方向”的格式保存
+func (s *RedisGameStore) PushDirection(gameID string, snakeID int, direction models.Direction) error {
+	pipe := s.client.TxPipeline()
+	pipe.RPush(Ctx, s.inputsKey(gameID), fmt.Sprintf("%d:%d", snakeID, direction))
+	pipe.Expire(Ctx, s.inputsKey(gameID), s.ttl)
+	_, err := pipe.Exec(Ctx)
+	return err
+}
+
+// PopDirections 在一次往返中取出多局游戏所有待处理的方向输入
+func (s *RedisGameStore) PopDirections(gameIDs []string) (map[string][]DirectionInput, error) {
+	if len(gameIDs) == 0 {
+		return nil, nil
+	}
+
+	pipe := s.client.TxPipeline()
+	values := make(map[string]*redis.StringSliceCmd, len(gameIDs))
+	for _, gameID := range gameIDs {
+		values[gameID] = pipe.LRange(Ctx, s.inputsKey(gameID), 0, -1)
+		pipe.Del(Ctx, s.inputsKey(gameID))
+	}
+	if _, err := pipe.Exec(Ctx); err != nil {
+		return nil, err
+	}
+
+	inputs := make(map[string][]DirectionInput)
+	for gameID, cmd := range values {
+		for _, value := range cmd.Val() {
+			var input DirectionInput
+			if _, err := fmt.Sscanf(value, "%d:%d", &input.SnakeID, &input.Direction); err == nil {
+				inputs[gameID] = append(inputs[gameID], input)
+			}
+		}
+	}
+	return inputs, nil
+}
+
+// Touch 以毫秒时间戳记录其他实例上的玩家活动时间
+func (s *RedisGameStore) Touch(gameID string, at time.Time) error {
+	return s.client.Set(Ctx, s.activityKey(gameID), at.UnixMilli(), s.ttl).Err()
+}
+
+// LastActivity 在一次往返中读取多局游戏在其他实例上的最后活动时间
+func (s *RedisGameStore) LastActivity(gameIDs []string) (map[string]time.Time, error) {
+	if len(gameIDs) == 0 {
+		return nil, nil
+	}
+
+	pipe := s.client.Pipeline()
+	values := make(map[string]*redis.StringCmd, len(gameIDs))
+	for _, gameID := range gameIDs {
+		values[gameID] = pipe.Get(Ctx, s.activityKey(gameID))
+	}
+	if _, err := pipe.Exec(Ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	activity := make(map[string]time.Time)
+	for gameID, cmd := range values {
+		if ms, err := cmd.Int64(); err == nil {
+			activity[gameID] = time.UnixMilli(ms)
+		}
+	}
+	return activity, nil
+}
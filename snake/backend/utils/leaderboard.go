@@ -0,0 +1,534 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/go-redis/redis/v8"
+	"github.com/lib/pq"
+)
+
+// 排行榜周期
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+	PeriodAll     = "all"
+)
+
+// Periods 所有排行榜周期
+var Periods = []string{PeriodDaily, PeriodWeekly, PeriodMonthly, PeriodAll}
+
+// 排行榜相关错误
+var (
+	ErrInvalidPeriod     = errors.New("无效的排行榜周期，可选daily、weekly、monthly、all")
+	ErrRecordNotFound    = errors.New("成绩记录不存在")
+	ErrPlayerNotRanked   = errors.New("该玩家在此排行榜上没有成绩")
+	ErrRecordNotInPeriod = errors.New("该成绩不在此周期的排行榜上")
+)
+
+// Redis中排行榜相关的键
+// 每个周期的每个分组一个有序集合，成员为补零到固定长度的game_records的id，分数为得分；
+// 得分相同时按成员倒序排列，与数据库查询的ORDER BY score DESC, id DESC一致；
+// 周期排行榜的键包含周期编号，新周期开始后自动写入新的键，旧的键到期后删除
+const (
+	redisLeaderboardKeyPrefix = "snake:leaderboard:"
+	redisLeaderboardReadyKey  = "snake:leaderboard:ready" // 重建完成的标记，不存在时从数据库查询
+)
+
+// LeaderboardBoard 排行榜分组，成绩只在同一模式、同一关卡版本、同样大小的空白棋盘之间比较
+type LeaderboardBoard struct {
+	Mode         string
+	Level        string
+	LevelVersion int
+	Width        int // 关卡的大小由关卡本身决定，关卡排行榜的宽高为0
+	Height       int
+}
+
+// key 分组在Redis键中的部分
+func (b LeaderboardBoard) key() string {
+	if b.Level != "" {
+		return fmt.Sprintf("%s:%s:%d", b.Mode, b.Level, b.LevelVersion)
+	}
+	return fmt.Sprintf("%s::%dx%d", b.Mode, b.Width, b.Height)
+}
+
+// LeaderboardRecord 写入排行榜的一条成绩
+type LeaderboardRecord struct {
+	ID        int64
+	Score     int
+	CreatedAt time.Time
+	Board     LeaderboardBoard
+}
+
+// LeaderboardItem 排行榜上的一条成绩
+type LeaderboardItem struct {
+	ID         int64     `json:"id"`
+	Rank       int       `json:"rank"` // 排名，得分相同的排名相同
+	PlayerName string    `json:"player_name"`
+	PlayerID   int64     `json:"player_id,omitempty"` // 注册玩家ID，游客的成绩为空
+	Score      int       `json:"score"`
+	TimePlayed int       `json:"time_played"`
+	FoodCount  int       `json:"food_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// LeaderboardPosition 一条成绩在排行榜上的位置
+type LeaderboardPosition struct {
+	Rank       int               `json:"rank"`
+	Total      int               `json:"total"`      // 排行榜上的成绩总数
+	Percentile float64           `json:"percentile"` // 排名低于这条成绩的比例（百分比）
+	TopPercent float64           `json:"topPercent"` // 排名位于前百分之多少，用于显示"前8%"
+	Record     LeaderboardItem   `json:"record"`
+	Entries    []LeaderboardItem `json:"entries"` // 这条成绩及其前后各k条成绩，按排名顺序
+}
+
+// leaderboardColumns 读取排行榜成绩详情的列，与scanLeaderboardItem对应
+const leaderboardColumns = "id, COALESCE(player_name, ''), COALESCE(player_id, 0), score, time_played, food_count, created_at"
+
+// leaderboardBoardFilter 按分组和周期筛选成绩的条件，参数从$1开始依次为模式、关卡、关卡版本、宽、高、周期开始时间
+const leaderboardBoardFilter = "mode = $1 AND level = $2 AND level_version = $3 AND ($4 = 0 OR (board_width = $4 AND board_height = $5)) AND created_at >= $6"
+
+// IsValidPeriod 判断排行榜周期是否有效
+func IsValidPeriod(period string) bool {
+	for _, p := range Periods {
+		if p == period {
+			return true
+		}
+	}
+	return false
+}
+
+// leaderboardLocation 划分日、周、月的时区（leaderboard.timezone，默认为服务器本地时区）
+func leaderboardLocation() *time.Location {
+	name := beego.AppConfig.DefaultString("leaderboard.timezone", "Local")
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Invalid leaderboard timezone %q, using local time: %v\n", name, err)
+		return time.Local
+	}
+	return loc
+}
+
+// periodRange 返回t所在周期的开始和结束时间，周从周一开始；总排行榜没有开始和结束时间
+func periodRange(period string, t time.Time) (time.Time, time.Time) {
+	t = t.In(leaderboardLocation())
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch period {
+	case PeriodDaily:
+		return day, day.AddDate(0, 0, 1)
+	case PeriodWeekly:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	case PeriodMonthly:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+	return time.Time{}, time.Time{}
+}
+
+// leaderboardKey t所在周期的排行榜键
+func leaderboardKey(board LeaderboardBoard, period string, t time.Time) string {
+	if period == PeriodAll {
+		return redisLeaderboardKeyPrefix + PeriodAll + ":" + board.key()
+	}
+	start, _ := periodRange(period, t)
+	return redisLeaderboardKeyPrefix + period + ":" + start.Format("20060102") + ":" + board.key()
+}
+
+// leaderboardMember 成绩在有序集合中的成员，补零使字典序与数字大小一致
+func leaderboardMember(id int64) string {
+	return fmt.Sprintf("%019d", id)
+}
+
+// addLeaderboardRecord 把成绩写入它所属的各个周期的排行榜，已经结束的周期跳过
+func addLeaderboardRecord(pipe redis.Pipeliner, record LeaderboardRecord, now time.Time) {
+	member := &redis.Z{Score: float64(record.Score), Member: leaderboardMember(record.ID)}
+	for _, period := range Periods {
+		key := leaderboardKey(record.Board, period, record.CreatedAt)
+		if period == PeriodAll {
+			pipe.ZAdd(Ctx, key, member)
+			continue
+		}
+		_, end := periodRange(period, record.CreatedAt)
+		if !end.After(now) {
+			continue
+		}
+		pipe.ZAdd(Ctx, key, member)
+		pipe.ExpireAt(Ctx, key, end)
+	}
+}
+
+// AddLeaderboardRecord 提交成绩时写入排行榜
+// 数据库是成绩的唯一来源，写入失败只记录日志，可以通过重建排行榜恢复
+func AddLeaderboardRecord(record LeaderboardRecord) {
+	if RedisClient == nil {
+		return
+	}
+	pipe := RedisClient.Pipeline()
+	addLeaderboardRecord(pipe, record, time.Now())
+	if _, err := pipe.Exec(Ctx); err != nil {
+		log.Printf("Failed to add record %d to leaderboard: %v\n", record.ID, err)
+	}
+}
+
+// InitLeaderboards 启动时Redis中还没有排行榜（首次启动或Redis数据丢失）则从数据库重建
+func InitLeaderboards() {
+	if DB == nil || RedisClient == nil {
+		return
+	}
+	ready, err := RedisClient.Exists(Ctx, redisLeaderboardReadyKey).Result()
+	if err != nil || ready > 0 {
+		return
+	}
+	if err := RebuildLeaderboards(); err != nil {
+		log.Printf("Failed to rebuild leaderboards: %v\n", err)
+	}
+}
+
+// RebuildLeaderboards 删除Redis中的所有排行榜，再用数据库中的成绩重新生成
+// 重建期间排行榜从数据库查询；先删除旧的键再读取成绩，重建期间提交的成绩不会丢失
+func RebuildLeaderboards() error {
+	if DB == nil || RedisClient == nil {
+		return errors.New("数据库或Redis不可用")
+	}
+
+	if err := RedisClient.Del(Ctx, redisLeaderboardReadyKey).Err(); err != nil {
+		return err
+	}
+	iter := RedisClient.Scan(Ctx, 0, redisLeaderboardKeyPrefix+"*", 1000).Iterator()
+	for iter.Next(Ctx) {
+		if err := RedisClient.Del(Ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	rows, err := DB.Query("SELECT id, score, created_at, mode, level, level_version, board_width, board_height FROM game_records")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	pipe := RedisClient.Pipeline()
+	count := 0
+	for rows.Next() {
+		var record LeaderboardRecord
+		board := &record.Board
+		if err := rows.Scan(&record.ID, &record.Score, &record.CreatedAt, &board.Mode, &board.Level, &board.LevelVersion, &board.Width, &board.Height); err != nil {
+			return err
+		}
+		if board.Level != "" {
+			board.Width, board.Height = 0, 0
+		}
+		addLeaderboardRecord(pipe, record, now)
+		count++
+		if count%1000 == 0 {
+			if _, err := pipe.Exec(Ctx); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	pipe.Set(Ctx, redisLeaderboardReadyKey, now.Unix(), 0)
+	if _, err := pipe.Exec(Ctx); err != nil {
+		return err
+	}
+
+	log.Println("Rebuilt leaderboards from", count, "records")
+	return nil
+}
+
+// boardArgs 分组和周期对应的查询参数，与leaderboardBoardFilter对应
+func boardArgs(board LeaderboardBoard, period string) []interface{} {
+	if board.Level != "" {
+		board.Width, board.Height = 0, 0
+	}
+	start, _ := periodRange(period, time.Now())
+	return []interface{}{board.Mode, board.Level, board.LevelVersion, board.Width, board.Height, start}
+}
+
+// leaderboardReady Redis中的排行榜是否可用
+func leaderboardReady() bool {
+	if RedisClient == nil {
+		return false
+	}
+	ready, err := RedisClient.Exists(Ctx, redisLeaderboardReadyKey).Result()
+	return err == nil && ready > 0
+}
+
+// GetLeaderboard 获取排行榜当前周期的前limit名
+// 优先从Redis读取，Redis不可用或排行榜尚未重建时从数据库查询
+func GetLeaderboard(board LeaderboardBoard, period string, limit int) ([]LeaderboardItem, error) {
+	if DB == nil {
+		return []LeaderboardItem{}, nil
+	}
+	if board.Level != "" {
+		board.Width, board.Height = 0, 0
+	}
+
+	if leaderboardReady() {
+		members, err := RedisClient.ZRevRange(Ctx, leaderboardKey(board, period, time.Now()), 0, int64(limit-1)).Result()
+		if err == nil {
+			items, err := leaderboardItems(members)
+			if err != nil {
+				return nil, err
+			}
+			return rankItems(items, 1, 0), nil
+		}
+		log.Printf("Failed to read leaderboard from Redis: %v\n", err)
+	}
+
+	args := append(boardArgs(board, period), limit)
+	items, err := queryLeaderboardItems(
+		"SELECT "+leaderboardColumns+" FROM game_records WHERE "+leaderboardBoardFilter+" ORDER BY score DESC, id DESC LIMIT $7",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return rankItems(items, 1, 0), nil
+}
+
+// GetLeaderboardRecord 读取成绩所在的排行榜分组和提交时间
+func GetLeaderboardRecord(id int64) (*LeaderboardRecord, error) {
+	if DB == nil {
+		return nil, ErrRecordNotFound
+	}
+	record := &LeaderboardRecord{ID: id}
+	board := &record.Board
+	err := DB.QueryRow(
+		"SELECT score, created_at, mode, level, level_version, board_width, board_height FROM game_records WHERE id = $1",
+		id,
+	).Scan(&record.Score, &record.CreatedAt, &board.Mode, &board.Level, &board.LevelVersion, &board.Width, &board.Height)
+	if err == sql.ErrNoRows {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if board.Level != "" {
+		board.Width, board.Height = 0, 0
+	}
+	return record, nil
+}
+
+// FindPlayerRecord 查找玩家在排行榜当前周期的最好成绩
+func FindPlayerRecord(board LeaderboardBoard, period, playerName string) (*LeaderboardRecord, error) {
+	if DB == nil {
+		return nil, ErrPlayerNotRanked
+	}
+	var id int64
+	args := append(boardArgs(board, period), playerName)
+	err := DB.QueryRow(
+		"SELECT id FROM game_records WHERE "+leaderboardBoardFilter+" AND player_name = $7 ORDER BY score DESC, id DESC LIMIT 1",
+		args...,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrPlayerNotRanked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetLeaderboardRecord(id)
+}
+
+// GetLeaderboardPosition 获取成绩在它所属分组当前周期排行榜上的排名、百分位，以及前后各k条成绩
+func GetLeaderboardPosition(record *LeaderboardRecord, period string, k int) (*LeaderboardPosition, error) {
+	if period != PeriodAll {
+		if start, _ := periodRange(period, time.Now()); record.CreatedAt.Before(start) {
+			return nil, ErrRecordNotInPeriod
+		}
+	}
+
+	if leaderboardReady() {
+		position, err := redisLeaderboardPosition(record, period, k)
+		if err == nil || err == ErrRecordNotInPeriod {
+			return position, err
+		}
+		log.Printf("Failed to read leaderboard position from Redis: %v\n", err)
+	}
+	return dbLeaderboardPosition(record, period, k)
+}
+
+// redisLeaderboardPosition 从Redis读取成绩的位置
+func redisLeaderboardPosition(record *LeaderboardRecord, period string, k int) (*LeaderboardPosition, error) {
+	key := leaderboardKey(record.Board, period, time.Now())
+	index, err := RedisClient.ZRevRank(Ctx, key, leaderboardMember(record.ID)).Result()
+	if err == redis.Nil {
+		return nil, ErrRecordNotInPeriod
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := RedisClient.Pipeline()
+	total := pipe.ZCard(Ctx, key)
+	higher := pipe.ZCount(Ctx, key, "("+strconv.Itoa(record.Score), "+inf")
+	first := index - int64(k)
+	if first < 0 {
+		first = 0
+	}
+	window := pipe.ZRevRangeWithScores(Ctx, key, first, index+int64(k))
+	if _, err := pipe.Exec(Ctx); err != nil {
+		return nil, err
+	}
+
+	// 窗口第一条成绩的排名为得分比它高的成绩数加1
+	members := make([]string, len(window.Val()))
+	for i, z := range window.Val() {
+		members[i] = z.Member.(string)
+	}
+	firstRank := int64(1)
+	if len(window.Val()) > 0 {
+		score := strconv.FormatFloat(window.Val()[0].Score, 'f', -1, 64)
+		if firstRank, err = RedisClient.ZCount(Ctx, key, "("+score, "+inf").Result(); err != nil {
+			return nil, err
+		}
+		firstRank++
+	}
+
+	items, err := leaderboardItems(members)
+	if err != nil {
+		return nil, err
+	}
+	return newLeaderboardPosition(record, int(higher.Val())+1, int(total.Val()), rankItems(items, int(firstRank), int(first)))
+}
+
+// dbLeaderboardPosition 从数据库查询成绩的位置
+func dbLeaderboardPosition(record *LeaderboardRecord, period string, k int) (*LeaderboardPosition, error) {
+	args := append(boardArgs(record.Board, period), record.Score, record.ID)
+	var total, higher, index int
+	err := DB.QueryRow(
+		"SELECT COUNT(*), COUNT(*) FILTER (WHERE score > $7), COUNT(*) FILTER (WHERE score > $7 OR (score = $7 AND id > $8)) FROM game_records WHERE "+leaderboardBoardFilter,
+		args...,
+	).Scan(&total, &higher, &index)
+	if err != nil {
+		return nil, err
+	}
+
+	first := index - k
+	if first < 0 {
+		first = 0
+	}
+	args = append(boardArgs(record.Board, period), 2*k+1, first)
+	items, err := queryLeaderboardItems(
+		"SELECT "+leaderboardColumns+" FROM game_records WHERE "+leaderboardBoardFilter+" ORDER BY score DESC, id DESC LIMIT $7 OFFSET $8",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	firstRank := 1
+	if len(items) > 0 {
+		err := DB.QueryRow(
+			"SELECT COUNT(*) FROM game_records WHERE "+leaderboardBoardFilter+" AND score > $7",
+			append(boardArgs(record.Board, period), items[0].Score)...,
+		).Scan(&firstRank)
+		if err != nil {
+			return nil, err
+		}
+		firstRank++
+	}
+	return newLeaderboardPosition(record, higher+1, total, rankItems(items, firstRank, first))
+}
+
+// newLeaderboardPosition 根据排名和窗口中的成绩生成位置
+func newLeaderboardPosition(record *LeaderboardRecord, rank, total int, entries []LeaderboardItem) (*LeaderboardPosition, error) {
+	position := &LeaderboardPosition{Rank: rank, Total: total, Entries: entries}
+	found := false
+	for _, item := range entries {
+		if item.ID == record.ID {
+			position.Record, found = item, true
+		}
+	}
+	if !found || total == 0 {
+		return nil, ErrRecordNotInPeriod
+	}
+	position.Percentile = math.Round(float64(total-rank)*1000/float64(total)) / 10
+	position.TopPercent = math.Ceil(float64(rank)*1000/float64(total)) / 10
+	return position, nil
+}
+
+// rankItems 为按排名顺序排列的成绩填写排名
+// firstRank为第一条成绩的排名，firstIndex为第一条成绩在排行榜中的位置（从0开始），得分相同的成绩排名相同
+func rankItems(items []LeaderboardItem, firstRank, firstIndex int) []LeaderboardItem {
+	for i := range items {
+		if i == 0 {
+			items[i].Rank = firstRank
+		} else if items[i].Score == items[i-1].Score {
+			items[i].Rank = items[i-1].Rank
+		} else {
+			items[i].Rank = firstIndex + i + 1
+		}
+	}
+	return items
+}
+
+// queryLeaderboardItems 查询排行榜成绩详情，查询的列必须为leaderboardColumns
+func queryLeaderboardItems(query string, args ...interface{}) ([]LeaderboardItem, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []LeaderboardItem{}
+	for rows.Next() {
+		item, err := scanLeaderboardItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// scanLeaderboardItem 读取一行leaderboardColumns
+func scanLeaderboardItem(rows *sql.Rows) (LeaderboardItem, error) {
+	var item LeaderboardItem
+	err := rows.Scan(&item.ID, &item.PlayerName, &item.PlayerID, &item.Score, &item.TimePlayed, &item.FoodCount, &item.CreatedAt)
+	return item, err
+}
+
+// leaderboardItems 按Redis中的排名顺序从数据库读取成绩详情
+func leaderboardItems(members []string) ([]LeaderboardItem, error) {
+	items := []LeaderboardItem{}
+	if len(members) == 0 {
+		return items, nil
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		if id, err := strconv.ParseInt(member, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	found, err := queryLeaderboardItems("SELECT "+leaderboardColumns+" FROM game_records WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]LeaderboardItem, len(found))
+	for _, item := range found {
+		byID[item.ID] = item
+	}
+	for _, id := range ids {
+		if item, ok := byID[id]; ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
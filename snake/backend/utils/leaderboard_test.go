@@ -0,0 +1,298 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego"
+)
+
+func TestPeriodRange(t *testing.T) {
+	beego.AppConfig.Set("leaderboard.timezone", "Asia/Shanghai")
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("缺少时区数据:", err)
+	}
+	at := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name      string
+		period    string
+		t         time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"日", PeriodDaily, at(2024, 3, 15, 13), at(2024, 3, 15, 0), at(2024, 3, 16, 0)},
+		{"日：按排行榜时区划分", PeriodDaily, time.Date(2024, 3, 15, 17, 0, 0, 0, time.UTC), at(2024, 3, 16, 0), at(2024, 3, 17, 0)},
+		{"周：周一", PeriodWeekly, at(2024, 3, 11, 0), at(2024, 3, 11, 0), at(2024, 3, 18, 0)},
+		{"周：周日属于上一周", PeriodWeekly, at(2024, 3, 17, 23), at(2024, 3, 11, 0), at(2024, 3, 18, 0)},
+		{"周：跨月", PeriodWeekly, at(2024, 3, 1, 8), at(2024, 2, 26, 0), at(2024, 3, 4, 0)},
+		{"周：跨年", PeriodWeekly, at(2025, 1, 1, 8), at(2024, 12, 30, 0), at(2025, 1, 6, 0)},
+		{"月：第一天", PeriodMonthly, at(2024, 2, 1, 0), at(2024, 2, 1, 0), at(2024, 3, 1, 0)},
+		{"月：闰年二月最后一天", PeriodMonthly, at(2024, 2, 29, 23), at(2024, 2, 1, 0), at(2024, 3, 1, 0)},
+		{"月：十二月", PeriodMonthly, at(2024, 12, 31, 12), at(2024, 12, 1, 0), at(2025, 1, 1, 0)},
+		{"总排行榜", PeriodAll, at(2024, 3, 15, 13), time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := periodRange(tt.period, tt.t)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("periodRange(%s, %v) = [%v, %v), want [%v, %v)", tt.period, tt.t, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+// items 按顺序构造排行榜成绩，ID从1开始
+func items(scores ...int) []LeaderboardItem {
+	result := make([]LeaderboardItem, len(scores))
+	for i, score := range scores {
+		result[i] = LeaderboardItem{ID: int64(i + 1), Score: score}
+	}
+	return result
+}
+
+// ranks 返回成绩的排名
+func ranks(items []LeaderboardItem) []int {
+	result := make([]int, len(items))
+	for i, item := range items {
+		result[i] = item.Rank
+	}
+	return result
+}
+
+func TestRankItems(t *testing.T) {
+	tests := []struct {
+		name       string
+		scores     []int
+		firstRank  int
+		firstIndex int
+		want       []int
+	}{
+		{"榜首", []int{90, 80, 70}, 1, 0, []int{1, 2, 3}},
+		{"并列第一", []int{90, 90, 80}, 1, 0, []int{1, 1, 3}},
+		{"全部并列", []int{50, 50, 50}, 1, 0, []int{1, 1, 1}},
+		{"窗口中间", []int{70, 60, 50}, 5, 4, []int{5, 6, 7}},
+		{"窗口第一条与前面的成绩并列", []int{60, 60, 50}, 3, 4, []int{3, 3, 7}},
+		{"窗口末尾并列", []int{60, 50, 50}, 9, 8, []int{9, 10, 10}},
+		{"空窗口", []int{}, 1, 0, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ranks(rankItems(items(tt.scores...), tt.firstRank, tt.firstIndex))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankItems() 排名 = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLeaderboardPosition(t *testing.T) {
+	window := rankItems(items(90, 80, 80), 1, 0)
+	tests := []struct {
+		name           string
+		id             int64
+		rank, total    int
+		wantPercentile float64
+		wantTop        float64
+		wantErr        error
+	}{
+		{"唯一的成绩", 1, 1, 1, 0, 100, nil},
+		{"榜首", 1, 1, 200, 99.5, 0.5, nil},
+		{"垫底", 3, 200, 200, 0, 100, nil},
+		{"并列", 3, 2, 3, 33.3, 66.7, nil},
+		{"不在窗口中", 9, 1, 3, 0, 0, ErrRecordNotInPeriod},
+		{"排行榜为空", 1, 1, 0, 0, 0, ErrRecordNotInPeriod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position, err := newLeaderboardPosition(&LeaderboardRecord{ID: tt.id}, tt.rank, tt.total, window)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if position.Record.ID != tt.id {
+				t.Errorf("Record.ID = %d, want %d", position.Record.ID, tt.id)
+			}
+			if position.Percentile != tt.wantPercentile || position.TopPercent != tt.wantTop {
+				t.Errorf("Percentile, TopPercent = %v, %v, want %v, %v", position.Percentile, position.TopPercent, tt.wantPercentile, tt.wantTop)
+			}
+		})
+	}
+}
+
+// scriptedDB 测试用的数据库连接，按顺序返回预先设定的查询结果，并记录每次查询的参数
+type scriptedDB struct {
+	results [][][]driver.Value // 每次查询返回的行
+	args    [][]driver.Value
+}
+
+func (db *scriptedDB) Connect(context.Context) (driver.Conn, error) { return db, nil }
+func (db *scriptedDB) Driver() driver.Driver                        { return nil }
+func (db *scriptedDB) Prepare(query string) (driver.Stmt, error)    { return db, nil }
+func (db *scriptedDB) Close() error                                 { return nil }
+func (db *scriptedDB) Begin() (driver.Tx, error)                    { return nil, errors.New("不支持事务") }
+func (db *scriptedDB) NumInput() int                                { return -1 }
+
+func (db *scriptedDB) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("不支持写入")
+}
+
+func (db *scriptedDB) Query(args []driver.Value) (driver.Rows, error) {
+	if len(db.results) == 0 {
+		return nil, errors.New("没有更多的查询结果")
+	}
+	db.args = append(db.args, args)
+	rows := &scriptedRows{rows: db.results[0]}
+	db.results = db.results[1:]
+	return rows, nil
+}
+
+type scriptedRows struct {
+	rows [][]driver.Value
+}
+
+func (r *scriptedRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *scriptedRows) Close() error { return nil }
+
+func (r *scriptedRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// useScriptedDB 在测试期间用scriptedDB替换数据库连接
+func useScriptedDB(t *testing.T, results ...[][]driver.Value) *scriptedDB {
+	script := &scriptedDB{results: results}
+	previous := DB
+	DB = sql.OpenDB(script)
+	t.Cleanup(func() {
+		DB.Close()
+		DB = previous
+	})
+	return script
+}
+
+// itemRow 一行leaderboardColumns
+func itemRow(id int64, score int) []driver.Value {
+	return []driver.Value{id, "player", int64(0), int64(score), int64(60), int64(5), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func TestLeaderboardWithoutDB(t *testing.T) {
+	previous := DB
+	DB = nil
+	defer func() { DB = previous }()
+
+	board := LeaderboardBoard{Mode: "classic", Width: 15, Height: 15}
+	got, err := GetLeaderboard(board, PeriodAll, 10)
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("GetLeaderboard() = %v, %v, want 空列表", got, err)
+	}
+	if _, err := GetLeaderboardRecord(1); err != ErrRecordNotFound {
+		t.Errorf("GetLeaderboardRecord() err = %v, want ErrRecordNotFound", err)
+	}
+	if _, err := FindPlayerRecord(board, PeriodAll, "player"); err != ErrPlayerNotRanked {
+		t.Errorf("FindPlayerRecord() err = %v, want ErrPlayerNotRanked", err)
+	}
+}
+
+func TestDBLeaderboardPosition(t *testing.T) {
+	if RedisClient != nil {
+		t.Skip("Redis可用时不会从数据库查询")
+	}
+	record := &LeaderboardRecord{ID: 5, Score: 50, Board: LeaderboardBoard{Mode: "classic", Width: 15, Height: 15}}
+
+	tests := []struct {
+		name        string
+		counts      []driver.Value // 总数、得分更高的数量、排在前面的数量
+		window      [][]driver.Value
+		firstHigher int64 // 得分比窗口第一条高的数量
+		wantLimit   int64
+		wantOffset  int64
+		wantRank    int
+		wantRanks   []int
+	}{
+		{
+			// 排行榜：80 70 60 55 50(6) 50(5) 40 30 20 10
+			name:        "中间并列",
+			counts:      []driver.Value{int64(10), int64(4), int64(5)},
+			window:      [][]driver.Value{itemRow(4, 55), itemRow(6, 50), itemRow(5, 50), itemRow(7, 40), itemRow(8, 30)},
+			firstHigher: 3,
+			wantLimit:   5,
+			wantOffset:  3,
+			wantRank:    5,
+			wantRanks:   []int{4, 5, 5, 7, 8},
+		},
+		{
+			// 排行榜：50(5) 40 30
+			name:        "榜首",
+			counts:      []driver.Value{int64(3), int64(0), int64(0)},
+			window:      [][]driver.Value{itemRow(5, 50), itemRow(7, 40), itemRow(8, 30)},
+			firstHigher: 0,
+			wantLimit:   5,
+			wantOffset:  0,
+			wantRank:    1,
+			wantRanks:   []int{1, 2, 3},
+		},
+		{
+			// 排行榜：70 60 50(6) 50(5)
+			name:        "垫底并列",
+			counts:      []driver.Value{int64(4), int64(2), int64(3)},
+			window:      [][]driver.Value{itemRow(2, 60), itemRow(6, 50), itemRow(5, 50)},
+			firstHigher: 1,
+			wantLimit:   5,
+			wantOffset:  1,
+			wantRank:    3,
+			wantRanks:   []int{2, 3, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := useScriptedDB(t,
+				[][]driver.Value{tt.counts},
+				tt.window,
+				[][]driver.Value{{tt.firstHigher}},
+			)
+
+			position, err := GetLeaderboardPosition(record, PeriodAll, 2)
+			if err != nil {
+				t.Fatalf("GetLeaderboardPosition: %v", err)
+			}
+			if position.Rank != tt.wantRank || position.Total != int(tt.counts[0].(int64)) {
+				t.Errorf("Rank, Total = %d, %d, want %d, %d", position.Rank, position.Total, tt.wantRank, tt.counts[0])
+			}
+			if got := ranks(position.Entries); !reflect.DeepEqual(got, tt.wantRanks) {
+				t.Errorf("窗口排名 = %v, want %v", got, tt.wantRanks)
+			}
+			if position.Record.ID != record.ID || position.Record.Rank != tt.wantRank {
+				t.Errorf("Record = %+v, want ID %d, Rank %d", position.Record, record.ID, tt.wantRank)
+			}
+
+			// 窗口查询的参数为分组参数之后的LIMIT和OFFSET
+			windowArgs := script.args[1]
+			limit, offset := windowArgs[len(windowArgs)-2], windowArgs[len(windowArgs)-1]
+			if limit != tt.wantLimit || offset != tt.wantOffset {
+				t.Errorf("LIMIT, OFFSET = %v, %v, want %d, %d", limit, offset, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
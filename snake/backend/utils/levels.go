@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"blockcade/models"
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"sync"
+
+	"github.com/astaxie/beego"
+)
+
+// 关卡编辑相关错误
+var (
+	ErrLevelNotFound    = errors.New("关卡不存在")
+	ErrLevelExists      = errors.New("关卡已存在")
+	ErrLevelBuiltin     = errors.New("内置关卡不能修改或删除")
+	ErrLevelNotOwner    = errors.New("只有关卡的创建者可以修改或删除关卡")
+	ErrInvalidLevelName = errors.New("关卡名称只能包含字母、数字、下划线和连字符，长度为1-50")
+)
+
+// levelNamePattern 关卡名称格式
+var levelNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,50}$`)
+
+// levelSaveMutex 保证同一实例上关卡的保存和删除依次进行
+var levelSaveMutex sync.Mutex
+
+// InitLevels 从配置的目录（level.dir，默认levels）加载关卡地图，再加载数据库中通过编辑器保存的关卡
+// 无效的关卡会被跳过并记录错误，不影响服务启动
+func InitLevels() {
+	dir := beego.AppConfig.DefaultString("level.dir", "levels")
+
+	loaded, errs := models.LoadLevels(dir)
+	for _, err := range errs {
+		log.Printf("Failed to load level: %v\n", err)
+	}
+	log.Println("Loaded", loaded, "levels from", dir)
+
+	if DB == nil {
+		return
+	}
+	rows, err := DB.Query("SELECT name, version, map, COALESCE(player_id, 0), deleted_at IS NOT NULL FROM levels ORDER BY name, version")
+	if err != nil {
+		log.Printf("Failed to load custom levels: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	// 最新版本已删除的关卡不再可用，但旧版本仍保留用于回放
+	deleted := make(map[string]bool)
+	custom := 0
+	for rows.Next() {
+		var name, data string
+		var version int
+		var playerID int64
+		var isDeleted bool
+		if err := rows.Scan(&name, &version, &data, &playerID, &isDeleted); err != nil {
+			log.Printf("Failed to scan level row: %v\n", err)
+			continue
+		}
+		deleted[name] = isDeleted
+		if registerCustomLevel(name, version, data, playerID) {
+			custom++
+		}
+	}
+	for name, isDeleted := range deleted {
+		if isDeleted {
+			models.UnregisterLevel(name)
+		}
+	}
+	log.Println("Loaded", custom, "custom level versions from database")
+}
+
+// registerCustomLevel 注册数据库中保存的关卡版本
+func registerCustomLevel(name string, version int, data string, playerID int64) bool {
+	level, err := models.ParseLevel(name, []byte(data))
+	if err != nil {
+		log.Printf("Failed to load custom level %s v%d: %v\n", name, version, err)
+		return false
+	}
+	level.Version = version
+	level.Custom = true
+	level.PlayerID = playerID
+	models.RegisterLevel(level)
+	return true
+}
+
+// ValidateCustomLevel 校验编辑器提交的关卡，返回所有问题
+// 除了通用的关卡校验，编辑器保存的关卡只能有一个出生点；与ParseLevel一样把默认的食物生成区域限制为可到达的空地
+func ValidateCustomLevel(name, data string) (*models.Level, []string) {
+	var problems []string
+	if !levelNamePattern.MatchString(name) {
+		problems = append(problems, ErrInvalidLevelName.Error())
+	}
+
+	level, err := models.ReadLevel(name, []byte(data))
+	if err != nil {
+		if levelErr, ok := err.(*models.LevelError); ok {
+			return nil, append(problems, levelErr.Problems...)
+		}
+		return nil, append(problems, err.Error())
+	}
+	problems = append(problems, level.Check()...)
+	if len(level.Spawns) > 1 {
+		problems = append(problems, "编辑器保存的关卡只能有一个出生点")
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	level.LimitFoodZone()
+	return level, nil
+}
+
+// RefreshLevel 从数据库同步关卡的最新版本，使其他实例保存或删除的关卡在本实例生效
+func RefreshLevel(name string) {
+	if DB == nil {
+		return
+	}
+	if level, ok := models.GetLevel(name); ok && !level.Custom {
+		return
+	}
+
+	var version int
+	var data string
+	var playerID int64
+	var isDeleted bool
+	err := DB.QueryRow(
+		"SELECT version, map, COALESCE(player_id, 0), deleted_at IS NOT NULL FROM levels WHERE name = $1 ORDER BY version DESC LIMIT 1",
+		name,
+	).Scan(&version, &data, &playerID, &isDeleted)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to refresh level %s: %v\n", name, err)
+		return
+	}
+	if isDeleted {
+		models.UnregisterLevel(name)
+		return
+	}
+	if current, ok := models.GetLevel(name); !ok || current.Version < version {
+		registerCustomLevel(name, version, data, playerID)
+	}
+}
+
+// SaveLevel 保存编辑器提交的关卡，每次保存生成一个新版本
+// create为true时关卡必须不存在，玩家成为关卡的创建者；否则关卡必须已存在，且只有创建者可以修改。
+// 关卡必须已通过ValidateCustomLevel校验
+func SaveLevel(level *models.Level, create bool, playerID int64) (*models.Level, error) {
+	levelSaveMutex.Lock()
+	defer levelSaveMutex.Unlock()
+
+	RefreshLevel(level.Name)
+	current, exists := models.GetLevel(level.Name)
+	if exists && !current.Custom {
+		return nil, ErrLevelBuiltin
+	}
+	if create && exists {
+		return nil, ErrLevelExists
+	}
+	if !create && !exists {
+		return nil, ErrLevelNotFound
+	}
+	// 之前保存的关卡没有创建者，不能再修改
+	if !create && current.PlayerID != playerID {
+		return nil, ErrLevelNotOwner
+	}
+
+	// 删除后重新创建的关卡延续原来的版本号，避免与旧版本的成绩混在一起
+	version := models.LatestLevelVersion(level.Name) + 1
+	if DB != nil {
+		err := DB.QueryRow(
+			"INSERT INTO levels (name, version, map, player_id) SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3 FROM levels WHERE name = $1 RETURNING version",
+			level.Name, level.Map, playerID,
+		).Scan(&version)
+		if err != nil {
+			if IsUniqueViolation(err) {
+				return nil, ErrLevelExists
+			}
+			return nil, err
+		}
+	}
+
+	level.Version = version
+	level.Custom = true
+	level.PlayerID = playerID
+	models.RegisterLevel(level)
+	return level, nil
+}
+
+// DeleteLevel 删除编辑器保存的关卡，只有创建者可以删除
+// 数据库中只做标记，已有版本仍可用于回放和查询排行榜
+func DeleteLevel(name string, playerID int64) error {
+	levelSaveMutex.Lock()
+	defer levelSaveMutex.Unlock()
+
+	RefreshLevel(name)
+	current, exists := models.GetLevel(name)
+	if !exists {
+		return ErrLevelNotFound
+	}
+	if !current.Custom {
+		return ErrLevelBuiltin
+	}
+	if current.PlayerID != playerID {
+		return ErrLevelNotOwner
+	}
+
+	if DB != nil {
+		_, err := DB.Exec("UPDATE levels SET deleted_at = CURRENT_TIMESTAMP WHERE name = $1 AND deleted_at IS NULL", name)
+		if err != nil {
+			return err
+		}
+	}
+
+	models.UnregisterLevel(name)
+	return nil
+}
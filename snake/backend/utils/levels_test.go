@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCustomLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    string
+		data     string
+		want     []string // 每个问题中应包含的内容，为空表示校验通过
+		wantZone int      // 校验通过时食物生成区域的格子数，0表示任意空地
+	}{
+		{
+			name:  "有效的关卡",
+			level: "arena_1",
+			data:  ".....\n.....\n..>..\n.....\n.....\n",
+		},
+		{
+			name:  "无效的名称",
+			level: "bad name!",
+			data:  ".....\n.....\n..>..\n.....\n.....\n",
+			want:  []string{"关卡名称"},
+		},
+		{
+			name:  "多个出生点",
+			level: "two",
+			data:  ".....\n..>..\n.....\n..>..\n.....\n",
+			want:  []string{"只能有一个出生点"},
+		},
+		{
+			name:  "无效的符号和名称同时报告",
+			level: "",
+			data:  ".....\n..?..\n.....\n",
+			want:  []string{"关卡名称", "无效的符号"},
+		},
+		{
+			name:  "关卡不可玩",
+			level: "blocked",
+			data:  ".....\n.....\n..>#.\n.....\n.....\n",
+			want:  []string{"正对边界、墙体或蛇身"},
+		},
+		{
+			name:     "封闭的空地不生成食物",
+			level:    "pocket",
+			data:     ".#...\n##...\n..>..\n.....\n.....\n",
+			wantZone: 21,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, problems := ValidateCustomLevel(tt.level, tt.data)
+			if len(problems) != len(tt.want) {
+				t.Fatalf("ValidateCustomLevel() = %q, want %d个问题", problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("第%d个问题 = %q, want 包含%q", i+1, problems[i], want)
+				}
+			}
+			if len(tt.want) > 0 {
+				if level != nil {
+					t.Errorf("校验失败时返回了关卡")
+				}
+				return
+			}
+			if len(level.FoodZone) != tt.wantZone {
+				t.Errorf("食物生成区域 = %d格, want %d格", len(level.FoodZone), tt.wantZone)
+			}
+		})
+	}
+}
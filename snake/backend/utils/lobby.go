@@ -0,0 +1,460 @@
+package utils
+
+import (
+	"blockcade/models"
+	"crypto/subtle"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego"
+)
+
+// 房间状态常量
+const (
+	RoomStatusOpen      = "open"      // 等待玩家加入和准备
+	RoomStatusCountdown = "countdown" // 满员且所有玩家已准备，倒计时结束后开始游戏
+	RoomStatusStarted   = "started"   // 游戏已开始
+)
+
+// 大厅相关错误
+var (
+	ErrRoomNotFound    = errors.New("房间不存在")
+	ErrRoomFull        = errors.New("房间已满或已开始")
+	ErrNotInRoom       = errors.New("玩家令牌无效")
+	ErrInvalidRoomSize = errors.New("无效的房间人数")
+	ErrInvalidMode     = errors.New("无效的游戏模式")
+	ErrInvalidBots     = errors.New("无效的机器人设置")
+)
+
+// Room 多人游戏房间
+type Room struct {
+	ID              string        `json:"id"`
+	Mode            string        `json:"mode"`
+	Size            int           `json:"size"` // 房间人数，满员后才能开始
+	Status          string        `json:"status"`
+	Players         []*RoomPlayer `json:"players"`
+	CountdownEndsAt *time.Time    `json:"countdownEndsAt,omitempty"` // 倒计时结束的时间
+	Countdown       int           `json:"countdown"`                 // 倒计时剩余秒数
+	GameID          string        `json:"gameId,omitempty"`          // 开始后的游戏ID
+	CreatedAt       time.Time     `json:"createdAt"`
+	UpdatedAt       time.Time     `json:"updatedAt"`
+
+	countdownSeq int // 每次开始或取消倒计时时递增，用于让过期的倒计时失效
+}
+
+// RoomPlayer 房间中的玩家
+type RoomPlayer struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	Bot   string `json:"bot,omitempty"` // 机器人难度，为空表示真人玩家
+
+	token        string // 玩家令牌，用于准备、离开和领取座位
+	controlToken string // 游戏开始后分配的控制令牌
+	snakeID      int    // 游戏开始后控制的蛇ID，入座失败时为models.NoSnake
+	playerID     int64  // 注册玩家ID，游客为0
+}
+
+// RoomSeat 玩家在已开始的游戏中的座位
+type RoomSeat struct {
+	GameID       string `json:"gameId"`
+	SnakeID      int    `json:"snakeId"`
+	ControlToken string `json:"controlToken"`
+}
+
+// Lobby 多人游戏大厅，负责房间管理和匹配
+// 房间只保存在本实例内存中
+type Lobby struct {
+	rooms     map[string]*Room
+	mutex     sync.Mutex
+	countdown time.Duration // 所有玩家准备后到游戏开始的倒计时
+	roomTTL   time.Duration // 房间无活动多久后移除
+}
+
+var lobby *Lobby
+var lobbyOnce sync.Once
+
+// GetLobby 获取大厅单例
+func GetLobby() *Lobby {
+	lobbyOnce.Do(func() {
+		countdown := beego.AppConfig.DefaultInt("lobby.countdown", 3) // 秒
+		roomTTL := beego.AppConfig.DefaultInt("lobby.room.ttl", 600)  // 秒
+
+		lobby = &Lobby{
+			rooms:     make(map[string]*Room),
+			countdown: time.Duration(countdown) * time.Second,
+			roomTTL:   time.Duration(roomTTL) * time.Second,
+		}
+	})
+
+	return lobby
+}
+
+// snapshot 复制房间当前状态，并计算倒计时剩余秒数（调用方需持有锁）
+func (r *Room) snapshot() Room {
+	room := *r
+	room.Players = make([]*RoomPlayer, len(r.Players))
+	for i, player := range r.Players {
+		copied := *player
+		room.Players[i] = &copied
+	}
+	if r.CountdownEndsAt != nil {
+		remaining := time.Until(*r.CountdownEndsAt)
+		room.Countdown = int((remaining + time.Second - 1) / time.Second)
+		if room.Countdown < 0 {
+			room.Countdown = 0
+		}
+	}
+	return room
+}
+
+// player 按玩家令牌查找房间中的玩家
+func (r *Room) player(token string) (int, *RoomPlayer) {
+	if token == "" {
+		return 0, nil
+	}
+	for i, player := range r.Players {
+		if player.Bot == "" && subtle.ConstantTimeCompare([]byte(player.token), []byte(token)) == 1 {
+			return i, player
+		}
+	}
+	return 0, nil
+}
+
+// humans 房间中真人玩家的数量
+func (r *Room) humans() int {
+	count := 0
+	for _, player := range r.Players {
+		if player.Bot == "" {
+			count++
+		}
+	}
+	return count
+}
+
+// allReady 房间是否满员且所有玩家都已准备
+func (r *Room) allReady() bool {
+	if len(r.Players) < r.Size {
+		return false
+	}
+	for _, player := range r.Players {
+		if !player.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// prune 移除长时间无活动的房间（调用方需持有锁）
+func (l *Lobby) prune(now time.Time) {
+	for roomID, room := range l.rooms {
+		if now.Sub(room.UpdatedAt) > l.roomTTL {
+			delete(l.rooms, roomID)
+		}
+	}
+}
+
+// join 把新玩家加入房间，返回玩家令牌（调用方需持有锁）
+// playerID为注册玩家ID，游客为0，游戏开始后蛇关联该玩家
+func (l *Lobby) join(room *Room, name string, playerID int64) (string, error) {
+	if room.Status != RoomStatusOpen || len(room.Players) >= room.Size {
+		return "", ErrRoomFull
+	}
+	if name == "" {
+		name = guestPlayerName
+	}
+
+	token := randomHex(32)
+	room.Players = append(room.Players, &RoomPlayer{Name: name, token: token, playerID: playerID})
+	room.UpdatedAt = time.Now()
+	return token, nil
+}
+
+// createRoom 创建空房间（调用方需持有锁）
+func (l *Lobby) createRoom(mode string, size int) (*Room, error) {
+	if size < 2 || size > models.MaxPlayers {
+		return nil, ErrInvalidRoomSize
+	}
+	if mode == "" {
+		mode = models.GameModeClassic
+	}
+	if !models.IsValidMode(mode) {
+		return nil, ErrInvalidMode
+	}
+
+	now := time.Now()
+	room := &Room{
+		ID:        randomHex(8),
+		Mode:      mode,
+		Size:      size,
+		Status:    RoomStatusOpen,
+		Players:   []*RoomPlayer{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	l.rooms[room.ID] = room
+	return room, nil
+}
+
+// CreateRoom 创建房间，创建者自动加入，返回房间和创建者的玩家令牌
+// bots个座位由难度为botDifficulty的机器人占据，机器人始终处于准备状态
+func (l *Lobby) CreateRoom(mode string, size int, playerName string, playerID int64, bots int, botDifficulty string) (Room, string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(time.Now())
+
+	if botDifficulty == "" {
+		botDifficulty = models.BotNormal
+	}
+	if bots < 0 || bots >= size || !models.IsValidBotDifficulty(botDifficulty) {
+		return Room{}, "", ErrInvalidBots
+	}
+
+	room, err := l.createRoom(mode, size)
+	if err != nil {
+		return Room{}, "", err
+	}
+	token, _ := l.join(room, playerName, playerID)
+	for i := 0; i < bots; i++ {
+		room.Players = append(room.Players, &RoomPlayer{Name: "Bot (" + botDifficulty + ")", Ready: true, Bot: botDifficulty})
+	}
+	return room.snapshot(), token, nil
+}
+
+// ListRooms 列出还有空位的房间，mode不为空时只列出该模式的房间
+func (l *Lobby) ListRooms(mode string) []Room {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(time.Now())
+
+	rooms := []Room{}
+	for _, room := range l.rooms {
+		if room.Status != RoomStatusOpen || len(room.Players) >= room.Size {
+			continue
+		}
+		if mode != "" && room.Mode != mode {
+			continue
+		}
+		rooms = append(rooms, room.snapshot())
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].CreatedAt.Before(rooms[j].CreatedAt)
+	})
+	return rooms
+}
+
+// GetRoom 获取房间状态
+// playerToken有效且游戏已开始时同时返回该玩家的座位，否则座位为nil
+func (l *Lobby) GetRoom(roomID, playerToken string) (Room, *RoomSeat, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(time.Now())
+
+	room, exists := l.rooms[roomID]
+	if !exists {
+		return Room{}, nil, ErrRoomNotFound
+	}
+
+	var seat *RoomSeat
+	// 游戏开始后、所有玩家入座前GameID为空
+	_, player := room.player(playerToken)
+	if player != nil && room.Status == RoomStatusStarted && room.GameID != "" && player.snakeID != models.NoSnake {
+		seat = &RoomSeat{GameID: room.GameID, SnakeID: player.snakeID, ControlToken: player.controlToken}
+	}
+	return room.snapshot(), seat, nil
+}
+
+// JoinRoom 加入房间，返回房间和玩家令牌
+func (l *Lobby) JoinRoom(roomID, playerName string, playerID int64) (Room, string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(time.Now())
+
+	room, exists := l.rooms[roomID]
+	if !exists {
+		return Room{}, "", ErrRoomNotFound
+	}
+	token, err := l.join(room, playerName, playerID)
+	if err != nil {
+		return Room{}, "", err
+	}
+	return room.snapshot(), token, nil
+}
+
+// Match 自动匹配：加入最早创建的、模式和人数相同且有空位的房间，没有时创建新房间
+func (l *Lobby) Match(mode string, size int, playerName string, playerID int64) (Room, string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(time.Now())
+
+	if mode == "" {
+		mode = models.GameModeClassic
+	}
+
+	var match *Room
+	for _, room := range l.rooms {
+		if room.Status != RoomStatusOpen || room.Mode != mode || room.Size != size || len(room.Players) >= room.Size {
+			continue
+		}
+		if match == nil || room.CreatedAt.Before(match.CreatedAt) {
+			match = room
+		}
+	}
+
+	if match == nil {
+		room, err := l.createRoom(mode, size)
+		if err != nil {
+			return Room{}, "", err
+		}
+		match = room
+	}
+
+	token, err := l.join(match, playerName, playerID)
+	if err != nil {
+		return Room{}, "", err
+	}
+	return match.snapshot(), token, nil
+}
+
+// SetReady 设置玩家的准备状态
+// 满员且所有玩家都准备后开始倒计时，倒计时期间有玩家取消准备则停止倒计时
+func (l *Lobby) SetReady(roomID, playerToken string, ready bool) (Room, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(time.Now())
+
+	room, exists := l.rooms[roomID]
+	if !exists {
+		return Room{}, ErrRoomNotFound
+	}
+	_, player := room.player(playerToken)
+	if player == nil {
+		return Room{}, ErrNotInRoom
+	}
+	if room.Status == RoomStatusStarted {
+		return Room{}, ErrRoomFull
+	}
+
+	player.Ready = ready
+	room.UpdatedAt = time.Now()
+	l.updateCountdown(room)
+	return room.snapshot(), nil
+}
+
+// LeaveRoom 离开尚未开始的房间，房间没有真人玩家后被移除
+func (l *Lobby) LeaveRoom(roomID, playerToken string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(time.Now())
+
+	room, exists := l.rooms[roomID]
+	if !exists {
+		return ErrRoomNotFound
+	}
+	index, player := room.player(playerToken)
+	if player == nil {
+		return ErrNotInRoom
+	}
+	if room.Status == RoomStatusStarted {
+		return ErrRoomFull
+	}
+
+	room.Players = append(room.Players[:index], room.Players[index+1:]...)
+	room.UpdatedAt = time.Now()
+	if room.humans() == 0 {
+		delete(l.rooms, roomID)
+		return nil
+	}
+	l.updateCountdown(room)
+	return nil
+}
+
+// updateCountdown 根据玩家的准备情况开始或取消倒计时（调用方需持有锁）
+func (l *Lobby) updateCountdown(room *Room) {
+	ready := room.allReady()
+	switch {
+	case ready && room.Status == RoomStatusOpen:
+		room.countdownSeq++
+		seq := room.countdownSeq
+		endsAt := time.Now().Add(l.countdown)
+		room.Status = RoomStatusCountdown
+		room.CountdownEndsAt = &endsAt
+
+		time.AfterFunc(l.countdown, func() {
+			l.startGame(room.ID, seq)
+		})
+	case !ready && room.Status == RoomStatusCountdown:
+		room.countdownSeq++
+		room.Status = RoomStatusOpen
+		room.CountdownEndsAt = nil
+	}
+}
+
+// pendingSeat 开始游戏时等待入座的玩家，入座在大厅锁外进行
+type pendingSeat struct {
+	player       *RoomPlayer // 房间中的玩家，只在持有锁时访问
+	playerID     int64
+	bot          string
+	snakeID      int    // 入座后分配的蛇ID，入座失败时为models.NoSnake
+	controlToken string // 入座后分配的控制令牌
+}
+
+// startGame 倒计时结束后为房间创建多人游戏并给每位玩家分配座位
+// 房间先在锁内标记为已开始，不再接受加入、准备和离开，创建游戏和入座在锁外进行
+func (l *Lobby) startGame(roomID string, seq int) {
+	l.mutex.Lock()
+	// 倒计时期间房间可能已被取消准备或移除
+	room, exists := l.rooms[roomID]
+	if !exists || room.Status != RoomStatusCountdown || room.countdownSeq != seq {
+		l.mutex.Unlock()
+		return
+	}
+
+	// 创建者的控制令牌对应第一条蛇，因此真人玩家排在机器人之前
+	sort.SliceStable(room.Players, func(i, j int) bool {
+		return room.Players[i].Bot == "" && room.Players[j].Bot != ""
+	})
+	seats := make([]*pendingSeat, len(room.Players))
+	for i, player := range room.Players {
+		seats[i] = &pendingSeat{player: player, playerID: player.playerID, bot: player.Bot, snakeID: models.NoSnake}
+	}
+	room.Status = RoomStatusStarted
+	room.CountdownEndsAt = nil
+	opts := models.GameOptions{Seed: models.NewSeed(), Mode: room.Mode, Players: room.Size}
+	l.mutex.Unlock()
+
+	gameID := seatPlayers(roomID, opts, seats)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, seat := range seats {
+		seat.player.snakeID, seat.player.controlToken = seat.snakeID, seat.controlToken
+	}
+	beego.Info("Room", roomID, "started game", gameID)
+	room.GameID = gameID
+	room.UpdatedAt = time.Now()
+}
+
+// seatPlayers 创建多人游戏并让玩家依次入座，记录每位玩家实际分配到的蛇ID，返回游戏ID
+// 创建者控制第一条蛇；入座失败的玩家蛇ID保持为models.NoSnake
+func seatPlayers(roomID string, opts models.GameOptions, seats []*pendingSeat) string {
+	gameManager := GetGameManager()
+	game, token := gameManager.CreateGame(NewGameID(), opts, seats[0].playerID)
+	seats[0].snakeID, seats[0].controlToken = 0, token
+	for _, seat := range seats[1:] {
+		var snakeID int
+		var err error
+		if seat.bot != "" {
+			snakeID, err = gameManager.AddBot(game.ID, seat.bot)
+		} else {
+			snakeID, seat.controlToken, err = gameManager.JoinGame(game.ID, seat.playerID)
+		}
+		if err != nil {
+			beego.Error("Failed to seat room player:", roomID, err)
+			continue
+		}
+		seat.snakeID = snakeID
+	}
+	return game.ID
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"blockcade/models"
+	"testing"
+)
+
+func TestSeatPlayers(t *testing.T) {
+	seats := []*pendingSeat{
+		{playerID: 7, snakeID: models.NoSnake},
+		{bot: models.BotEasy, snakeID: models.NoSnake},
+		{snakeID: models.NoSnake},
+	}
+	opts := models.GameOptions{Seed: 1, Mode: models.GameModeClassic, Players: len(seats)}
+	gameID := seatPlayers("room", opts, seats)
+
+	gm := GetGameManager()
+	defer gm.RemoveGame(gameID)
+	game, err := gm.GetGame(gameID)
+	if err != nil {
+		t.Fatalf("GetGame: %v", err)
+	}
+	for i, seat := range seats {
+		snake := game.Snake(seat.snakeID)
+		if snake == nil {
+			t.Fatalf("座位%d: 蛇ID %d 不存在", i, seat.snakeID)
+		}
+		if (snake.Bot != "") != (seat.bot != "") {
+			t.Errorf("座位%d: 蛇%d 的机器人难度为 %q", i, seat.snakeID, snake.Bot)
+		}
+		if seat.bot != "" {
+			continue
+		}
+		if snakeID, err := gm.CheckControlToken(gameID, seat.controlToken); err != nil || snakeID != seat.snakeID {
+			t.Errorf("座位%d: 控制令牌对应蛇 %d, %v, want %d", i, snakeID, err, seat.snakeID)
+		}
+	}
+
+	// 游戏已开始，之后的玩家无法入座
+	late := []*pendingSeat{{snakeID: models.NoSnake}, {snakeID: models.NoSnake}}
+	lateID := seatPlayers("room", models.GameOptions{Mode: models.GameModeClassic, Players: 1}, late)
+	defer gm.RemoveGame(lateID)
+	if late[1].snakeID != models.NoSnake || late[1].controlToken != "" {
+		t.Errorf("超出座位的玩家分配到蛇 %d", late[1].snakeID)
+	}
+}
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 玩家账号相关错误
+var (
+	ErrAccountsUnavailable = errors.New("数据库不可用，暂时不能注册或登录")
+	ErrInvalidPlayerName   = errors.New("玩家名称只能包含字母、数字、下划线、连字符和中文，长度为2-20，且不能使用默认名称Player")
+	ErrWeakPassword        = errors.New("密码长度必须在8到72个字节之间")
+	ErrPlayerExists        = errors.New("玩家名称已被注册")
+	ErrInvalidCredentials  = errors.New("玩家名称或密码错误")
+	ErrInvalidSession      = errors.New("登录已失效，请重新登录")
+)
+
+// 密码长度限制，bcrypt只使用前72个字节
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// playerNamePattern 玩家名称格式
+var playerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_\-\p{Han}]{2,20}$`)
+
+// guestPlayerName 游客和大厅玩家未填写名称时使用的默认名称，不能被注册
+const guestPlayerName = "Player"
+
+// Player 注册玩家
+type Player struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Session 会话令牌中携带的登录信息
+type Session struct {
+	PlayerID  int64     `json:"pid"`
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+var (
+	sessionSecret     []byte
+	sessionSecretOnce sync.Once
+)
+
+// getSessionSecret 会话令牌的签名密钥（session.secret）
+// 未配置时使用随机密钥，服务重启后所有会话失效，多实例部署时必须配置相同的密钥
+func getSessionSecret() []byte {
+	sessionSecretOnce.Do(func() {
+		secret := beego.AppConfig.String("session.secret")
+		if secret == "" {
+			log.Println("session.secret is not set, using a random secret; sessions will not survive restarts")
+			secret = randomHex(32)
+		}
+		sessionSecret = []byte(secret)
+	})
+	return sessionSecret
+}
+
+// sessionTTL 会话令牌的有效期（session.ttl，单位小时，默认7天）
+func sessionTTL() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("session.ttl", 168)) * time.Hour
+}
+
+// signSession 计算会话令牌载荷的签名
+func signSession(payload string) []byte {
+	mac := hmac.New(sha256.New, getSessionSecret())
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// IssueSessionToken 为玩家签发会话令牌，令牌由载荷和HMAC-SHA256签名组成，服务器不保存会话
+func IssueSessionToken(player *Player) (string, Session) {
+	session := Session{PlayerID: player.ID, Name: player.Name, ExpiresAt: time.Now().Add(sessionTTL()).Truncate(time.Second)}
+	data, _ := json.Marshal(session)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signSession(payload)), session
+}
+
+// ParseSessionToken 校验会话令牌的签名和有效期，返回登录信息
+func ParseSessionToken(token string) (*Session, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signSession(payload)) {
+		return nil, ErrInvalidSession
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil || session.PlayerID <= 0 || time.Now().After(session.ExpiresAt) {
+		return nil, ErrInvalidSession
+	}
+	return &session, nil
+}
+
+// validatePlayer 校验注册时的玩家名称和密码
+func validatePlayer(name, password string) error {
+	if !playerNamePattern.MatchString(name) || strings.EqualFold(name, guestPlayerName) {
+		return ErrInvalidPlayerName
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// RegisterPlayer 注册玩家，密码以bcrypt摘要保存；名称不区分大小写，不能与已注册的玩家重复
+func RegisterPlayer(name, password string) (*Player, error) {
+	if DB == nil {
+		return nil, ErrAccountsUnavailable
+	}
+	if err := validatePlayer(name, password); err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	player := &Player{Name: name}
+	err = DB.QueryRow(
+		"INSERT INTO players (name, password_hash) VALUES ($1, $2) RETURNING id, created_at",
+		name, string(hash),
+	).Scan(&player.ID, &player.CreatedAt)
+	if err != nil {
+		if IsUniqueViolation(err) {
+			return nil, ErrPlayerExists
+		}
+		return nil, err
+	}
+	return player, nil
+}
+
+// AuthenticatePlayer 校验玩家名称和密码
+// 玩家不存在时同样计算一次bcrypt，避免通过响应时间判断名称是否已注册
+func AuthenticatePlayer(name, password string) (*Player, error) {
+	if DB == nil {
+		return nil, ErrAccountsUnavailable
+	}
+
+	player := &Player{}
+	var hash string
+	err := DB.QueryRow(
+		"SELECT id, name, password_hash, created_at FROM players WHERE LOWER(name) = LOWER($1)",
+		name,
+	).Scan(&player.ID, &player.Name, &hash, &player.CreatedAt)
+	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return player, nil
+}
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// dummyPasswordHash 用于玩家不存在时比较的bcrypt摘要
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte(randomHex(16)), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+// GetPlayer 按ID获取玩家
+func GetPlayer(id int64) (*Player, error) {
+	if DB == nil {
+		return nil, ErrAccountsUnavailable
+	}
+	player := &Player{}
+	err := DB.QueryRow("SELECT id, name, created_at FROM players WHERE id = $1", id).Scan(&player.ID, &player.Name, &player.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return player, nil
+}
+
+// IsRegisteredName 判断名称是否已被注册玩家使用，游客不能用这些名称提交成绩
+func IsRegisteredName(name string) (bool, error) {
+	if DB == nil {
+		return false, nil
+	}
+	var exists bool
+	err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM players WHERE LOWER(name) = LOWER($1))", name).Scan(&exists)
+	return exists, err
+}
+
+// NewClaimToken 生成游客成绩的认领令牌，返回令牌及保存在数据库中的摘要
+func NewClaimToken() (string, string) {
+	token := randomHex(32)
+	sum := sha256.Sum256([]byte(token))
+	return token, hex.EncodeToString(sum[:])
+}
+
+// ClaimRecords 把认领令牌对应的游客成绩归到玩家名下，成绩的玩家名称改为玩家的名称
+// 已被认领的成绩和无效的令牌会被忽略，返回认领的成绩数
+func ClaimRecords(playerID int64, playerName string, tokens []string) (int, error) {
+	if DB == nil {
+		return 0, ErrAccountsUnavailable
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+
+	hashes := make([]string, len(tokens))
+	for i, token := range tokens {
+		sum := sha256.Sum256([]byte(token))
+		hashes[i] = hex.EncodeToString(sum[:])
+	}
+	result, err := DB.Exec(
+		"UPDATE game_records SET player_id = $1, player_name = $2, claim_hash = NULL WHERE player_id IS NULL AND claim_hash = ANY($3)",
+		playerID, playerName, pq.Array(hashes),
+	)
+	if err != nil {
+		return 0, err
+	}
+	claimed, err := result.RowsAffected()
+	return int(claimed), err
+}
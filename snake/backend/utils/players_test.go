@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedToken 用服务器的密钥为任意载荷签名
+func signedToken(payload string) string {
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signSession(payload))
+}
+
+// sessionPayload 序列化会话作为令牌载荷
+func sessionPayload(session Session) string {
+	data, _ := json.Marshal(session)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestParseSessionToken(t *testing.T) {
+	valid, session := IssueSessionToken(&Player{ID: 7, Name: "tester"})
+	payload, sig, _ := strings.Cut(valid, ".")
+	forged := sessionPayload(Session{PlayerID: 8, Name: "other", ExpiresAt: session.ExpiresAt})
+	otherKey := hmac.New(sha256.New, []byte("another secret"))
+	otherKey.Write([]byte(payload))
+
+	// 篡改签名的第一个字符；最后一个字符含有填充位，改动后可能解码出相同的签名
+	flipped := "A"
+	if sig[0] == 'A' {
+		flipped = "B"
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"有效", valid, true},
+		{"篡改签名", payload + "." + flipped + sig[1:], false},
+		{"篡改载荷", forged + "." + sig, false},
+		{"其他密钥签名", payload + "." + base64.RawURLEncoding.EncodeToString(otherKey.Sum(nil)), false},
+		{"缺少签名", payload, false},
+		{"签名为空", payload + ".", false},
+		{"空令牌", "", false},
+		{"签名不是base64", payload + ".!!!", false},
+		{"多余的分隔符", valid + ".x", false},
+		{"已过期", signedToken(sessionPayload(Session{PlayerID: 7, Name: "tester", ExpiresAt: time.Now().Add(-time.Second)})), false},
+		{"载荷不是base64", signedToken("!!!"), false},
+		{"载荷不是JSON", signedToken(base64.RawURLEncoding.EncodeToString([]byte("not json"))), false},
+		{"没有玩家ID", signedToken(sessionPayload(Session{Name: "tester", ExpiresAt: session.ExpiresAt})), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSessionToken(tt.token)
+			if !tt.valid {
+				if err != ErrInvalidSession || got != nil {
+					t.Errorf("ParseSessionToken() = %v, %v, want ErrInvalidSession", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSessionToken: %v", err)
+			}
+			if got.PlayerID != session.PlayerID || got.Name != session.Name || !got.ExpiresAt.Equal(session.ExpiresAt) {
+				t.Errorf("ParseSessionToken() = %+v, want %+v", *got, session)
+			}
+		})
+	}
+}
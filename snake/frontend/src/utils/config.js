@@ -5,7 +5,7 @@ export default {
   
   // 游戏配置
   game: {
-    // 游戏区域大小
+    // 默认游戏区域大小，实际大小以服务器返回的游戏状态为准
     width: 15,
     height: 15,
     
@@ -5,6 +5,85 @@ export class GameService {
     // 请求配置
     this.maxRetries = 2;
     this.timeout = 3000;
+    // 登录状态，保存在localStorage中，刷新页面后仍然有效
+    this.sessionToken = localStorage.getItem("sessionToken");
+    this.player = JSON.parse(localStorage.getItem("player") || "null");
+  }
+
+  // 登录玩家的请求头，游客为空
+  authHeaders() {
+    return this.sessionToken
+      ? { Authorization: `Bearer ${this.sessionToken}` }
+      : {};
+  }
+
+  // 游客保存成绩后得到的认领令牌，注册或登录时用来认领成绩
+  claimTokens() {
+    return JSON.parse(localStorage.getItem("claimTokens") || "[]");
+  }
+
+  // 保存登录状态
+  setSession(data) {
+    this.sessionToken = data.sessionToken;
+    this.player = data.player;
+    localStorage.setItem("sessionToken", data.sessionToken);
+    localStorage.setItem("player", JSON.stringify(data.player));
+  }
+
+  // 退出登录
+  logout() {
+    this.sessionToken = null;
+    this.player = null;
+    localStorage.removeItem("sessionToken");
+    localStorage.removeItem("player");
+  }
+
+  // 发送注册、登录或认领请求
+  async postPlayer(path, body) {
+    const url = `${this.apiBaseUrl}/players/${path}`;
+    const response = await this.fetchWithRetry(url, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        ...this.authHeaders(),
+      },
+      body: JSON.stringify(body),
+    });
+    const data = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      console.error(`玩家账号API错误数据:`, data);
+      throw new Error(data.error || response.statusText);
+    }
+    return data;
+  }
+
+  // 注册并登录，同时认领以游客身份保存的成绩
+  async register(name, password) {
+    const data = await this.postPlayer("register", {
+      name,
+      password,
+      claimTokens: this.claimTokens(),
+    });
+    this.setSession(data);
+    localStorage.removeItem("claimTokens");
+    return data;
+  }
+
+  // 登录，并认领登录前以游客身份保存的成绩
+  async login(name, password) {
+    const data = await this.postPlayer("login", { name, password });
+    this.setSession(data);
+    const tokens = this.claimTokens();
+    if (tokens.length > 0) {
+      try {
+        const result = await this.postPlayer("claim", { claimTokens: tokens });
+        data.claimed = result.claimed;
+        localStorage.removeItem("claimTokens");
+      } catch (error) {
+        console.error(`认领成绩失败:`, error);
+      }
+    }
+    return data;
   }
 
   // 带重试和超时的fetch请求
@@ -38,8 +117,8 @@ export class GameService {
     }
   }
 
-  // 创建新游戏
-  async createGame() {
+  // 创建新游戏，options为可选的创建参数，例如{ countdown: true }
+  async createGame(options = {}) {
     const url = `${this.apiBaseUrl}/game`;
     console.log(`正在创建新游戏: ${url}`);
     try {
@@ -47,12 +126,20 @@ export class GameService {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
+          ...this.authHeaders(),
         },
+        body: JSON.stringify(options),
       });
       console.log(
         `创建游戏API响应状态: ${response.status}, ${response.statusText}`
       );
 
+      // 登录已失效时退出登录，以游客身份重试
+      if (response.status === 401 && this.sessionToken) {
+        this.logout();
+        return this.createGame(options);
+      }
+
       if (!response.ok) {
         const errorData = await response.json().catch(() => ({}));
         console.error(`创建游戏API错误数据:`, errorData);
@@ -91,8 +178,76 @@ export class GameService {
     }
   }
 
+  // 暂停（paused为true）或继续游戏
+  async setPaused(gameId, paused, token) {
+    const action = paused ? "pause" : "resume";
+    const url = `${this.apiBaseUrl}/game/${gameId}/${action}`;
+    console.log(`正在${paused ? "暂停" : "继续"}游戏: ${url}`);
+    try {
+      const response = await this.fetchWithRetry(url, {
+        method: "POST",
+        headers: {
+          "X-Control-Token": token,
+        },
+      });
+
+      const data = await response.json().catch(() => ({}));
+      if (!response.ok) {
+        console.error(`${action}游戏API错误数据:`, data);
+        throw new Error(data.error || `${action}游戏失败: ${response.statusText}`);
+      }
+      return data;
+    } catch (error) {
+      console.error(`${action}游戏时发生异常:`, error);
+      throw error;
+    }
+  }
+
+  // 建立游戏状态WebSocket连接
+  // 服务器每次更新游戏后推送最新状态，方向变化也通过同一连接发送
+  // 提供控制令牌时才能发送方向，否则只能观战
+  openGameSocket(gameId, { token, onState, onError, onClose } = {}) {
+    const protocol = window.location.protocol === "https:" ? "wss:" : "ws:";
+    const query = token ? `?token=${encodeURIComponent(token)}` : "";
+    const url = `${protocol}//${window.location.host}${this.apiBaseUrl}/game/${gameId}/ws${query}`;
+    console.log(`正在建立游戏WebSocket连接: ${url}`);
+
+    const socket = new WebSocket(url);
+    socket.onmessage = (event) => {
+      const data = JSON.parse(event.data);
+      if (data.error) {
+        console.error(`WebSocket错误消息:`, data.error);
+        onError?.(new Error(data.error));
+        return;
+      }
+      onState?.(data);
+    };
+    socket.onerror = (event) => {
+      console.error(`WebSocket连接异常:`, event);
+      onError?.(new Error("WebSocket连接异常"));
+    };
+    socket.onclose = () => {
+      console.log(`WebSocket连接已关闭`);
+      onClose?.();
+    };
+
+    return {
+      // 发送方向（小写字符串）
+      sendDirection(direction) {
+        if (socket.readyState !== WebSocket.OPEN) {
+          return false;
+        }
+        socket.send(JSON.stringify({ direction: direction.toLowerCase() }));
+        return true;
+      },
+      close() {
+        socket.close();
+      },
+    };
+  }
+
   // 更新游戏方向
-  async updateDirection(gameId, direction) {
+  async updateDirection(gameId, direction, token) {
     const url = `${this.apiBaseUrl}/game/${gameId}/direction`;
     console.log(`正在更新游戏方向: ${url}, 方向: ${direction}`);
     try {
@@ -111,6 +266,7 @@ export class GameService {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
+          "X-Control-Token": token,
         },
         body: JSON.stringify(requestBody),
       };
@@ -137,7 +293,7 @@ export class GameService {
   }
 
   // 保存游戏记录
-  async saveScore(gameId, playerName, score) {
+  async saveScore(gameId, playerName, score, token) {
     const url = `${this.apiBaseUrl}/game/${gameId}/record`;
     console.log(
       `正在保存游戏记录: ${url}, 玩家: ${playerName}, 得分: ${score}`
@@ -147,6 +303,7 @@ export class GameService {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
+          "X-Control-Token": token,
         },
         body: JSON.stringify({ playerName, score }),
       });
@@ -162,6 +319,12 @@ export class GameService {
 
       const data = await response.json();
       console.log(`成功保存游戏记录:`, data);
+      if (data.claimToken) {
+        localStorage.setItem(
+          "claimTokens",
+          JSON.stringify([...this.claimTokens(), data.claimToken])
+        );
+      }
       return data;
     } catch (error) {
       console.error(`保存游戏记录时发生异常:`, error);
@@ -169,9 +332,30 @@ export class GameService {
     }
   }
 
-  // 获取排行榜
-  async getLeaderboard() {
-    const url = `${this.apiBaseUrl}/leaderboard`;
+  // 获取成绩在排行榜上的排名、百分位和前后的成绩
+  async getRank(recordId, period = 'all') {
+    const url = `${this.apiBaseUrl}/leaderboard/rank?record=${recordId}&period=${encodeURIComponent(period)}`;
+    console.log(`正在获取排名: ${url}`);
+    try {
+      const response = await this.fetchWithRetry(url);
+      if (!response.ok) {
+        const errorData = await response.json().catch(() => ({}));
+        console.error(`获取排名API错误数据:`, errorData);
+        throw new Error(`获取排名失败: ${response.statusText}`);
+      }
+
+      const data = await response.json();
+      console.log(`成功获取排名:`, data);
+      return data;
+    } catch (error) {
+      console.error(`获取排名时发生异常:`, error);
+      throw error;
+    }
+  }
+
+  // 获取排行榜，period为daily、weekly、monthly或all
+  async getLeaderboard(period = 'all') {
+    const url = `${this.apiBaseUrl}/leaderboard?period=${encodeURIComponent(period)}`;
     console.log(`正在获取排行榜: ${url}`);
     try {
       const response = await this.fetchWithRetry(url);